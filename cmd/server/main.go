@@ -0,0 +1,204 @@
+// Package main 是 pai-smart-go 服务端的启动入口。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"pai-smart-go/internal/config"
+	"pai-smart-go/internal/handler"
+	"pai-smart-go/internal/pipeline"
+	"pai-smart-go/internal/repository"
+	"pai-smart-go/internal/service"
+	"pai-smart-go/pkg/database"
+	"pai-smart-go/pkg/embedding"
+	"pai-smart-go/pkg/es"
+	"pai-smart-go/pkg/kafka"
+	"pai-smart-go/pkg/llm"
+	"pai-smart-go/pkg/log"
+	"pai-smart-go/pkg/rerank"
+	"pai-smart-go/pkg/storage"
+	"pai-smart-go/pkg/tika"
+	"pai-smart-go/pkg/token"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// shutdownTimeout 是收到退出信号后等待在途请求完成的最长时间。
+	shutdownTimeout = 30 * time.Second
+	// deletionReconcileInterval 是重试未完成文档删除的间隔。
+	deletionReconcileInterval = 5 * time.Minute
+	// reindexRecoverInterval 是检查中断的重建索引任务的间隔。
+	reindexRecoverInterval = time.Minute
+)
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "配置文件路径")
+	flag.Parse()
+
+	// 1. 加载配置并初始化日志
+	config.Init(*configPath)
+	cfg := config.Conf
+	log.Init(cfg.Log.Level, cfg.Log.Format, cfg.Log.OutputPath)
+	defer log.Sync()
+	log.Infof("配置加载成功: %s", *configPath)
+
+	// 2. 初始化基础设施
+	database.InitMySQL(cfg.Database.MySQL.DSN)
+	database.InitRedis(cfg.Database.Redis.Addr, cfg.Database.Redis.Password, cfg.Database.Redis.DB)
+	storage.InitMinIO(cfg.MinIO)
+	if err := es.InitES(cfg.Elasticsearch, cfg.Embedding); err != nil {
+		log.Fatal("初始化 Elasticsearch 失败", err)
+	}
+	kafka.InitProducer(cfg.Kafka)
+
+	// 3. 外部服务客户端
+	jwtManager := token.NewJWTManager(cfg.JWT.Secret, cfg.JWT.AccessTokenExpireHours, cfg.JWT.RefreshTokenExpireDays)
+	tikaClient := tika.NewClient(cfg.Tika)
+	// 检索、文件处理与重建索引共用同一个可切换的 embedding 客户端
+	embeddingClient := embedding.NewSwitchableClient(cfg.Embedding)
+	// 未启用重排序时为 nil
+	reranker := rerank.NewClient(cfg.Rerank)
+	llmClient, err := llm.NewClient(cfg.LLM)
+	if err != nil {
+		log.Fatal("初始化 LLM 客户端失败", err)
+	}
+
+	// 4. 数据访问层
+	userRepo := repository.NewUserRepository(database.DB)
+	orgTagRepo := repository.NewOrgTagRepository(database.DB)
+	uploadRepo := repository.NewUploadRepository(database.DB, database.RDB)
+	docVectorRepo := repository.NewDocumentVectorRepository(database.DB)
+	conversationRepo := repository.NewConversationRepository(database.DB, database.RDB)
+	conversationLogRepo := repository.NewConversationLogRepository(database.DB)
+	reindexRepo := repository.NewReindexRepository(database.RDB)
+	deadLetterRepo := repository.NewDeadLetterRepository(database.RDB)
+
+	// 5. 业务逻辑层
+	userService := service.NewUserService(userRepo, orgTagRepo, jwtManager)
+	adminService := service.NewAdminService(orgTagRepo, userRepo, conversationLogRepo)
+	uploadService := service.NewUploadService(uploadRepo, userRepo, userService, cfg.MinIO, cfg.Elasticsearch, cfg.Upload)
+	documentService := service.NewDocumentService(uploadRepo, userRepo, orgTagRepo, cfg.MinIO, cfg.Elasticsearch, tikaClient)
+	searchService := service.NewSearchService(embeddingClient, es.ESClient, userService, uploadRepo, cfg.Elasticsearch, cfg.Search, reranker, cfg.Rerank)
+	chatService := service.NewChatService(searchService, llmClient, conversationRepo, conversationLogRepo)
+	conversationService := service.NewConversationService(conversationRepo, conversationLogRepo)
+	reindexService := service.NewReindexService(embeddingClient, cfg.Elasticsearch, docVectorRepo, uploadRepo, reindexRepo)
+	deadLetterService := service.NewDeadLetterService(deadLetterRepo, uploadRepo)
+	processor := pipeline.NewProcessor(tikaClient, embeddingClient, cfg.Elasticsearch, cfg.MinIO, cfg.Embedding, cfg.Chunking, uploadRepo, docVectorRepo)
+	consumer := kafka.NewConsumer(cfg.Kafka, processor, deadLetterService)
+
+	// 6. 控制器层
+	handlers := &routeHandlers{
+		user:         handler.NewUserHandler(userService),
+		auth:         handler.NewAuthHandler(userService),
+		admin:        handler.NewAdminHandler(adminService, userService),
+		upload:       handler.NewUploadHandler(uploadService),
+		document:     handler.NewDocumentHandler(documentService, userService),
+		search:       handler.NewSearchHandler(searchService),
+		conversation: handler.NewConversationHandler(conversationService),
+		chat:         handler.NewChatHandler(chatService, userService, jwtManager),
+		reindex:      handler.NewReindexHandler(reindexService),
+		deadLetter:   handler.NewDeadLetterHandler(deadLetterService),
+		health:       handler.NewHealthHandler(consumer),
+	}
+
+	// 7. 监听退出信号
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// 8. 启动 Kafka 消费者（文件处理流水线），退出信号到达后停止拉取并等待在途任务完成
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumer.Run(ctx)
+	}()
+
+	// 9. 启动后台对账任务
+	go func() {
+		if _, err := documentService.MigrateObjectKeys(ctx); err != nil {
+			log.Errorf("迁移合并文件对象键失败: %v", err)
+		}
+	}()
+	go runPeriodically(ctx, "文档删除对账", deletionReconcileInterval, func(ctx context.Context) error {
+		_, err := documentService.ReconcilePendingDeletions(ctx)
+		return err
+	})
+	go runPeriodically(ctx, "过期上传清理", cfg.Upload.JanitorInterval(), func(ctx context.Context) error {
+		_, err := uploadService.CleanupStaleUploads(ctx)
+		return err
+	})
+	// 其他实例异常退出时遗留的 running 任务在其锁过期后才能识别，因此启动时检查一次后定期检查
+	go func() {
+		if err := reindexService.RecoverInterruptedJob(ctx); err != nil {
+			log.Errorf("检查中断的重建索引任务失败: %v", err)
+		}
+		runPeriodically(ctx, "中断重建任务检查", reindexRecoverInterval, reindexService.RecoverInterruptedJob)
+	}()
+
+	// 10. 启动 HTTP 服务
+	gin.SetMode(cfg.Server.Mode)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: setupRouter(handlers, jwtManager, userService),
+	}
+	go func() {
+		log.Infof("HTTP 服务启动，监听端口: %s", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("HTTP 服务启动失败", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Info("收到退出信号，开始优雅关闭...")
+
+	// 11. 依次关闭 HTTP 服务、Kafka 与数据库连接
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("HTTP 服务关闭失败", err)
+	}
+	// 中断正在运行的重建索引任务，使其在连接关闭前记录失败状态并清理新索引
+	reindexService.Stop(shutdownCtx)
+
+	select {
+	case <-consumerDone:
+	case <-shutdownCtx.Done():
+		log.Warnf("等待 Kafka 消费者退出超时")
+	}
+	if err := kafka.CloseProducer(); err != nil {
+		log.Error("关闭 Kafka 生产者失败", err)
+	}
+
+	if err := database.RDB.Close(); err != nil {
+		log.Error("关闭 Redis 连接失败", err)
+	}
+	if sqlDB, err := database.DB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Error("关闭 MySQL 连接失败", err)
+		}
+	}
+
+	log.Info("服务已退出")
+}
+
+// runPeriodically 按固定间隔执行后台任务，直到 ctx 被取消。
+func runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				log.Errorf("后台任务 '%s' 执行失败: %v", name, err)
+			}
+		}
+	}
+}
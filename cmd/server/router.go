@@ -0,0 +1,107 @@
+package main
+
+import (
+	"pai-smart-go/internal/handler"
+	"pai-smart-go/internal/middleware"
+	"pai-smart-go/internal/service"
+	"pai-smart-go/pkg/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeHandlers 汇总了注册路由所需的全部控制器。
+type routeHandlers struct {
+	user         *handler.UserHandler
+	auth         *handler.AuthHandler
+	admin        *handler.AdminHandler
+	upload       *handler.UploadHandler
+	document     *handler.DocumentHandler
+	search       *handler.SearchHandler
+	conversation *handler.ConversationHandler
+	chat         *handler.ChatHandler
+	reindex      *handler.ReindexHandler
+	deadLetter   *handler.DeadLetterHandler
+	health       *handler.HealthHandler
+}
+
+// setupRouter 创建 Gin 引擎并注册完整的路由表。
+func setupRouter(h *routeHandlers, jwtManager *token.JWTManager, userService service.UserService) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), middleware.RequestLogger())
+
+	// WebSocket 对话入口，token 通过路径传递，由 ChatHandler 自行校验
+	r.GET("/chat/:token", h.chat.Handle)
+
+	api := r.Group("/api/v1")
+
+	// 无需认证的接口
+	api.POST("/users/register", h.user.Register)
+	api.POST("/users/login", h.user.Login)
+	api.POST("/auth/refreshToken", h.auth.RefreshToken)
+
+	// 需要认证的接口
+	auth := api.Group("")
+	auth.Use(middleware.AuthMiddleware(jwtManager, userService))
+
+	users := auth.Group("/users")
+	{
+		users.GET("/me", h.user.GetProfile)
+		users.POST("/logout", h.user.Logout)
+		users.PUT("/primary-org", h.user.SetPrimaryOrg)
+		users.GET("/org-tags", h.user.GetUserOrgTags)
+		users.GET("/conversation", h.conversation.GetConversations)
+		users.GET("/conversations", h.conversation.ListSessions)
+		users.POST("/conversations", h.conversation.CreateSession)
+		users.GET("/conversations/:conversationId/messages", h.conversation.GetConversationMessages)
+		users.PUT("/conversations/:conversationId", h.conversation.RenameSession)
+		users.POST("/conversations/:conversationId/switch", h.conversation.SwitchSession)
+		users.DELETE("/conversations/:conversationId", h.conversation.DeleteSession)
+	}
+
+	upload := auth.Group("/upload")
+	{
+		upload.POST("/check", h.upload.CheckFile)
+		upload.POST("/chunk", h.upload.UploadChunk)
+		upload.POST("/merge", h.upload.MergeChunks)
+		upload.POST("/fast-upload", h.upload.FastUpload)
+		upload.GET("/status", h.upload.GetUploadStatus)
+		upload.GET("/supported-types", h.upload.GetSupportedFileTypes)
+	}
+
+	documents := auth.Group("/documents")
+	{
+		documents.GET("/accessible", h.document.ListAccessibleFiles)
+		documents.GET("/uploads", h.document.ListUploadedFiles)
+		documents.GET("/:fileMd5/status", h.document.GetProcessingStatus)
+		documents.DELETE("/:fileMd5", h.document.DeleteDocument)
+		documents.GET("/download", h.document.GenerateDownloadURL)
+		documents.GET("/preview", h.document.PreviewFile)
+	}
+
+	auth.GET("/search/hybrid", h.search.HybridSearch)
+	auth.GET("/chat/websocket-token", h.chat.GetWebsocketStopToken)
+
+	admin := auth.Group("/admin")
+	admin.Use(middleware.AdminAuthMiddleware())
+	{
+		admin.GET("/users/list", h.admin.ListUsers)
+		admin.PUT("/users/:userId/org-tags", h.admin.AssignOrgTagsToUser)
+		admin.GET("/conversation", h.admin.GetAllConversations)
+		admin.POST("/org-tags", h.admin.CreateOrganizationTag)
+		admin.GET("/org-tags", h.admin.ListOrganizationTags)
+		admin.GET("/org-tags/tree", h.admin.GetOrganizationTagTree)
+		admin.PUT("/org-tags/:id", h.admin.UpdateOrganizationTag)
+		admin.DELETE("/org-tags/:id", h.admin.DeleteOrganizationTag)
+		admin.POST("/reindex", h.reindex.StartReindex)
+		admin.GET("/reindex", h.reindex.GetLatestReindexJob)
+		admin.GET("/reindex/:jobId", h.reindex.GetReindexJob)
+		admin.GET("/dead-letters", h.deadLetter.ListDeadLetters)
+		admin.GET("/dead-letters/:id", h.deadLetter.GetDeadLetter)
+		admin.POST("/dead-letters/:id/replay", h.deadLetter.ReplayDeadLetter)
+		admin.GET("/kafka/workers", h.health.GetKafkaWorkers)
+		admin.POST("/documents/reprocess", h.document.ReprocessDocuments)
+		admin.GET("/uploads/stale", h.upload.GetStaleUploads)
+	}
+
+	return r
+}
@@ -35,10 +35,19 @@ CREATE TABLE file_upload (
                              is_public    TINYINT(1)       NOT NULL DEFAULT 0 COMMENT '是否公开',
                              created_at   TIMESTAMP        NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
                              merged_at    TIMESTAMP        NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT '合并时间',
+                             object_key   VARCHAR(255)     NOT NULL DEFAULT '' COMMENT '合并文件在 MinIO 中的对象键',
+                             last_chunk_at TIMESTAMP       NULL DEFAULT NULL COMMENT '最后一次上传分片的时间',
+                             processing_status     VARCHAR(20)  NOT NULL DEFAULT '' COMMENT '处理状态: queued/extracting/chunking/embedding/indexing/ready/failed',
+                             chunk_count           INT          NOT NULL DEFAULT 0 COMMENT '文本分块数',
+                             indexed_count         INT          NOT NULL DEFAULT 0 COMMENT '已写入索引的分块数',
+                             processing_error      TEXT         NULL COMMENT '最近一次处理失败的错误信息',
+                             processing_updated_at TIMESTAMP    NULL DEFAULT NULL COMMENT '处理状态更新时间',
                              PRIMARY KEY (id),
                              UNIQUE KEY uk_md5_user (file_md5, user_id),
                              INDEX idx_user (user_id),
-                             INDEX idx_org_tag (org_tag)
+                             INDEX idx_org_tag (org_tag),
+                             INDEX idx_object_key (object_key),
+                             INDEX idx_status_created (status, created_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='文件上传记录';
 
 
@@ -63,6 +72,28 @@ CREATE TABLE document_vectors (
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='文档向量存储表';
 
 
+CREATE TABLE conversations (
+                               id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '问答记录唯一标识',
+                               user_id BIGINT NOT NULL COMMENT '提问用户ID',
+                               conversation_id VARCHAR(64) NOT NULL COMMENT '所属会话ID',
+                               question TEXT NOT NULL COMMENT '用户问题',
+                               answer TEXT NOT NULL COMMENT '模型回答',
+                               sources JSON DEFAULT NULL COMMENT '本轮检索到的文档分块',
+                               created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+                               INDEX idx_user_id (user_id),
+                               INDEX idx_conversation_id (conversation_id),
+                               INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='对话记录表';
+
+CREATE TABLE conversation_sessions (
+                                       conversation_id VARCHAR(64) NOT NULL PRIMARY KEY COMMENT '会话ID',
+                                       user_id BIGINT NOT NULL COMMENT '所属用户ID',
+                                       title VARCHAR(255) NOT NULL COMMENT '会话标题',
+                                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+                                       updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '最后更新时间',
+                                       INDEX idx_user_updated (user_id, updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='对话会话表';
+
 INSERT INTO users (username, password, role) VALUES ('admin', '$2a$10$CuNbcCAjuZPTu/VnBT/kgeU4Pu.bcEo23GJxvugZt/3yTQ8iIF4hC', 'ADMIN');
 INSERT INTO users (username, password, role) VALUES ('testuser', '$2a$10$zUiAOXogIuHnNyR7vf8Q3usknDJcvmbc.36Kl2iC0gdAWyrecoGZa', 'USER');
 
@@ -0,0 +1,43 @@
+-- 从旧版本升级已有数据库时执行的结构变更，新部署直接使用 ddl.sql 即可。
+-- 按顺序执行一次；MySQL 不支持 ADD COLUMN IF NOT EXISTS，已执行过的语句会因字段或索引已存在而报错，跳过即可。
+
+
+-- 合并文件按用户保存在 merged/{userId}/{fileMd5}，对象键记录在 object_key 中。
+-- 服务启动后会把 merged/{fileName} 下的旧对象迁移到新的对象键。
+ALTER TABLE file_upload
+    ADD COLUMN object_key VARCHAR(255) NOT NULL DEFAULT '' COMMENT '合并文件在 MinIO 中的对象键' AFTER merged_at,
+    ADD INDEX idx_object_key (object_key);
+
+
+-- 过期的分片上传按最后一次上传分片的时间清理。
+ALTER TABLE file_upload
+    ADD COLUMN last_chunk_at TIMESTAMP NULL DEFAULT NULL COMMENT '最后一次上传分片的时间' AFTER object_key,
+    ADD INDEX idx_status_created (status, created_at);
+
+
+-- 文档处理进度。升级前已处理完成的文件状态为空字符串，可通过重新处理接口补齐。
+ALTER TABLE file_upload
+    ADD COLUMN processing_status     VARCHAR(20) NOT NULL DEFAULT '' COMMENT '处理状态: queued/extracting/chunking/embedding/indexing/ready/failed' AFTER last_chunk_at,
+    ADD COLUMN chunk_count           INT         NOT NULL DEFAULT 0 COMMENT '文本分块数' AFTER processing_status,
+    ADD COLUMN indexed_count         INT         NOT NULL DEFAULT 0 COMMENT '已写入索引的分块数' AFTER chunk_count,
+    ADD COLUMN processing_error      TEXT        NULL COMMENT '最近一次处理失败的错误信息' AFTER indexed_count,
+    ADD COLUMN processing_updated_at TIMESTAMP   NULL DEFAULT NULL COMMENT '处理状态更新时间' AFTER processing_error;
+
+
+-- 对话记录按会话归组并保存检索来源。升级前的记录不属于任何会话，conversation_id 为空字符串。
+ALTER TABLE conversations
+    ADD COLUMN conversation_id VARCHAR(64) NOT NULL DEFAULT '' COMMENT '所属会话ID' AFTER user_id,
+    ADD COLUMN sources JSON DEFAULT NULL COMMENT '本轮检索到的文档分块' AFTER answer,
+    ADD INDEX idx_conversation_id (conversation_id),
+    ADD INDEX idx_created_at (created_at);
+
+
+-- 会话与标题保存在 MySQL 中。升级前的记录不属于任何会话，不会出现在会话列表中。
+CREATE TABLE conversation_sessions (
+    conversation_id VARCHAR(64) NOT NULL PRIMARY KEY COMMENT '会话ID',
+    user_id BIGINT NOT NULL COMMENT '所属用户ID',
+    title VARCHAR(255) NOT NULL COMMENT '会话标题',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '最后更新时间',
+    INDEX idx_user_updated (user_id, updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='对话会话表';
@@ -3,6 +3,9 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -19,8 +22,12 @@ type Config struct {
 	Kafka         KafkaConfig         `mapstructure:"kafka"`
 	Tika          TikaConfig          `mapstructure:"tika"`
 	Elasticsearch ElasticsearchConfig `mapstructure:"elasticsearch"`
+	Search        SearchConfig        `mapstructure:"search"`
 	MinIO         MinIOConfig         `mapstructure:"minio"`
+	Upload        UploadConfig        `mapstructure:"upload"`
 	Embedding     EmbeddingConfig     `mapstructure:"embedding"`
+	Rerank        RerankConfig        `mapstructure:"rerank"`
+	Chunking      ChunkingConfig      `mapstructure:"chunking"`
 	LLM           LLMConfig           `mapstructure:"llm"`
 	AI            AIConfig            `mapstructure:"ai"`
 }
@@ -67,6 +74,34 @@ type LogConfig struct {
 type KafkaConfig struct {
 	Brokers string `mapstructure:"brokers"`
 	Topic   string `mapstructure:"topic"`
+	// Workers 是每个主题并发处理任务的工作协程数，默认为 4
+	Workers int `mapstructure:"workers"`
+	// RetryTopic 存放等待延迟重试的任务，默认为 "<topic>-retry"
+	RetryTopic string `mapstructure:"retry_topic"`
+	// DeadLetterTopic 存放重试耗尽的任务及其错误，默认为 "<topic>-dlq"
+	DeadLetterTopic string `mapstructure:"dead_letter_topic"`
+	// MaxAttempts 是单个任务的最大处理次数（含首次），默认为 3
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryBackoffSeconds 是首次重试的延迟，之后每次翻倍，默认为 10 秒
+	RetryBackoffSeconds int `mapstructure:"retry_backoff_seconds"`
+	// MaxRetryBackoffSeconds 是单次重试延迟的上限，默认为 600 秒
+	MaxRetryBackoffSeconds int `mapstructure:"max_retry_backoff_seconds"`
+}
+
+// RetryTopicName 返回重试主题名，未配置时由主主题派生。
+func (c KafkaConfig) RetryTopicName() string {
+	if c.RetryTopic != "" {
+		return c.RetryTopic
+	}
+	return c.Topic + "-retry"
+}
+
+// DeadLetterTopicName 返回死信主题名，未配置时由主主题派生。
+func (c KafkaConfig) DeadLetterTopicName() string {
+	if c.DeadLetterTopic != "" {
+		return c.DeadLetterTopic
+	}
+	return c.Topic + "-dlq"
 }
 
 // TikaConfig 存储 Tika 服务器相关的配置。
@@ -82,6 +117,105 @@ type ElasticsearchConfig struct {
 	IndexName string `mapstructure:"index_name"`
 }
 
+// 混合检索支持的融合策略。
+const (
+	// FusionRescore 先做带权限过滤的 kNN + BM25 检索，再以 BM25（operator=and）对召回窗口重打分
+	FusionRescore = "rescore"
+	// FusionRRF 分别取 kNN 与 BM25 的结果列表，按倒数排名融合（Reciprocal Rank Fusion）
+	FusionRRF = "rrf"
+	// FusionLinear 分别取 kNN 与 BM25 的结果列表，将两路分数按最大最小值归一化后加权求和
+	FusionLinear = "linear"
+)
+
+// SearchConfig 存储混合检索的排序配置，各项均可被单次请求覆盖。
+type SearchConfig struct {
+	// Fusion 是默认融合策略：rescore（默认）、rrf、linear
+	Fusion  string              `mapstructure:"fusion"`
+	Rescore FusionWeightsConfig `mapstructure:"rescore"`
+	RRF     RRFConfig           `mapstructure:"rrf"`
+	Linear  FusionWeightsConfig `mapstructure:"linear"`
+	// Highlight 是 BM25 命中片段的高亮配置
+	Highlight HighlightConfig `mapstructure:"highlight"`
+}
+
+// HighlightConfig 存储检索结果高亮片段的配置。
+type HighlightConfig struct {
+	PreTag  string `mapstructure:"pre_tag"`
+	PostTag string `mapstructure:"post_tag"`
+	// FragmentSize 是每个片段的字符数，默认为 100
+	FragmentSize int `mapstructure:"fragment_size"`
+	// NumberOfFragments 是每个分块最多返回的片段数，默认为 3
+	NumberOfFragments int `mapstructure:"number_of_fragments"`
+}
+
+// Tags 返回高亮的前后标签，未配置的一项分别默认为 <em> 与 </em>。
+func (c HighlightConfig) Tags() (string, string) {
+	pre, post := c.PreTag, c.PostTag
+	if pre == "" {
+		pre = "<em>"
+	}
+	if post == "" {
+		post = "</em>"
+	}
+	return pre, post
+}
+
+// Fragments 返回片段字符数与每个分块的最大片段数。
+func (c HighlightConfig) Fragments() (int, int) {
+	size, n := c.FragmentSize, c.NumberOfFragments
+	if size <= 0 {
+		size = 100
+	}
+	if n <= 0 {
+		n = 3
+	}
+	return size, n
+}
+
+// FusionWeightsConfig 是 kNN 与 BM25 两路的权重，两项均为 0 时使用策略的默认权重。
+type FusionWeightsConfig struct {
+	KNNWeight  float64 `mapstructure:"knn_weight"`
+	BM25Weight float64 `mapstructure:"bm25_weight"`
+}
+
+// RRFConfig 是倒数排名融合的参数。
+type RRFConfig struct {
+	FusionWeightsConfig `mapstructure:",squash"`
+	// RankConstant 是 RRF 公式 w / (k + rank) 中的 k（rank 从 1 开始），默认为 60
+	RankConstant int `mapstructure:"rank_constant"`
+}
+
+// FusionName 返回默认融合策略。
+func (c SearchConfig) FusionName() string {
+	if c.Fusion == "" {
+		return FusionRescore
+	}
+	return c.Fusion
+}
+
+// Weights 返回指定融合策略的权重，未配置时 rescore 为 0.2/1.0（与 Java 版本一致），rrf 与 linear 为 1.0/1.0。
+func (c SearchConfig) Weights(fusion string) FusionWeightsConfig {
+	w, def := c.Rescore, FusionWeightsConfig{KNNWeight: 0.2, BM25Weight: 1.0}
+	switch fusion {
+	case FusionRRF:
+		w, def = c.RRF.FusionWeightsConfig, FusionWeightsConfig{KNNWeight: 1.0, BM25Weight: 1.0}
+	case FusionLinear:
+		w, def = c.Linear, FusionWeightsConfig{KNNWeight: 1.0, BM25Weight: 1.0}
+	}
+	if w.KNNWeight == 0 && w.BM25Weight == 0 {
+		return def
+	}
+	return w
+}
+
+// RRFRankConstant 返回 RRF 的排名常数。
+func (c SearchConfig) RRFRankConstant() int {
+	if c.RRF.RankConstant <= 0 {
+		return 60
+	}
+	return c.RRF.RankConstant
+}
+
 // MinIOConfig 存储 MinIO 对象存储的配置。
 type MinIOConfig struct {
 	Endpoint        string `mapstructure:"endpoint"`
@@ -91,21 +225,116 @@ type MinIOConfig struct {
 	BucketName      string `mapstructure:"bucket_name"`
 }
 
+// UploadConfig 存储分片上传相关的配置。
+type UploadConfig struct {
+	// TTLHours 是未完成上传自最后一次上传分片起的保留时长，超过后由后台任务清理，默认为 24 小时
+	TTLHours int `mapstructure:"ttl_hours"`
+	// JanitorIntervalMinutes 是后台清理过期上传的间隔，默认为 30 分钟
+	JanitorIntervalMinutes int `mapstructure:"janitor_interval_minutes"`
+}
+
+// TTL 返回未完成上传的保留时长。
+func (c UploadConfig) TTL() time.Duration {
+	if c.TTLHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(c.TTLHours) * time.Hour
+}
+
+// JanitorInterval 返回后台清理过期上传的间隔。
+func (c UploadConfig) JanitorInterval() time.Duration {
+	if c.JanitorIntervalMinutes <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.JanitorIntervalMinutes) * time.Minute
+}
+
 // EmbeddingConfig 存储 Embedding 模型相关的配置。
 type EmbeddingConfig struct {
-	APIKey     string `mapstructure:"api_key"`
-	BaseURL    string `mapstructure:"base_url"`
-	Model      string `mapstructure:"model"`
-	Dimensions int    `mapstructure:"dimensions"`
+	APIKey      string `mapstructure:"api_key"`
+	BaseURL     string `mapstructure:"base_url"`
+	Model       string `mapstructure:"model"`
+	Dimensions  int    `mapstructure:"dimensions"`
+	BatchSize   int    `mapstructure:"batch_size"`  // 单次请求携带的文本条数
+	Concurrency int    `mapstructure:"concurrency"` // 文件处理时并发请求数上限
+	MaxRetries  *int   `mapstructure:"max_retries"` // 遇到 429/5xx 时的最大重试次数，见 Retries
+}
+
+// Retries 返回遇到 429/5xx 时的最大重试次数，未配置时为 3，配置为 0 时不重试。
+func (c EmbeddingConfig) Retries() int {
+	if c.MaxRetries == nil {
+		return 3
+	}
+	if *c.MaxRetries < 0 {
+		return 0
+	}
+	return *c.MaxRetries
+}
+
+// RerankConfig 存储检索后重排序（cross-encoder）模型的配置。
+// 接口为 Cohere / Jina 风格的 POST {base_url}/rerank，未启用时检索结果按召回分数返回。
+type RerankConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	APIKey  string `mapstructure:"api_key"`
+	BaseURL string `mapstructure:"base_url"`
+	Model   string `mapstructure:"model"`
+	// CandidateMultiplier 决定送入重排序的候选数（topK × 该值），默认为 3
+	CandidateMultiplier int `mapstructure:"candidate_multiplier"`
+	// MinScore 大于 0 时，重排序分数低于该值的结果被丢弃，默认不过滤
+	MinScore float64 `mapstructure:"min_score"`
+	// TimeoutSeconds 是单次重排序请求的超时，默认为 10 秒；超时或出错时退回召回顺序
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+}
+
+// Candidates 返回 topK 对应的重排序候选数。
+func (c RerankConfig) Candidates(topK int) int {
+	if c.CandidateMultiplier <= 0 {
+		return topK * 3
+	}
+	return topK * c.CandidateMultiplier
+}
+
+// Timeout 返回单次重排序请求的超时。
+func (c RerankConfig) Timeout() time.Duration {
+	if c.TimeoutSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// ChunkingConfig 存储文本切块相关的配置。
+// FileTypes 的键为不带点的小写扩展名（如 "md"、"pdf"），未配置的类型使用 Default。
+type ChunkingConfig struct {
+	Default   ChunkStrategyConfig            `mapstructure:"default"`
+	FileTypes map[string]ChunkStrategyConfig `mapstructure:"file_types"`
+}
+
+// ChunkStrategyConfig 描述一种切块策略及其参数。
+type ChunkStrategyConfig struct {
+	Strategy     string `mapstructure:"strategy"`      // recursive: 按结构递归切分（按 token 计）；fixed: 固定窗口（按字符计）
+	ChunkSize    int    `mapstructure:"chunk_size"`    // 单个分块的最大长度
+	ChunkOverlap int    `mapstructure:"chunk_overlap"` // 相邻分块的重叠长度
+}
+
+// ForFile 返回指定文件应使用的切块策略。
+func (c ChunkingConfig) ForFile(fileName string) ChunkStrategyConfig {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	if s, ok := c.FileTypes[ext]; ok {
+		return s
+	}
+	return c.Default
 }
 
 // LLMConfig 存储大语言模型相关的配置。
 type LLMConfig struct {
-	APIKey     string              `mapstructure:"api_key"`
-	BaseURL    string              `mapstructure:"base_url"`
-	Model      string              `mapstructure:"model"`
-	Generation LLMGenerationConfig `mapstructure:"generation"`
-	Prompt     LLMPromptConfig     `mapstructure:"prompt"`
+	Provider      string              `mapstructure:"provider"` // openai（默认，OpenAI 兼容）、deepseek、ollama、anthropic、fake
+	APIKey        string              `mapstructure:"api_key"`
+	BaseURL       string              `mapstructure:"base_url"`
+	Model         string              `mapstructure:"model"`
+	Headers       map[string]string   `mapstructure:"headers"`        // 附加请求头，会覆盖 provider 默认的鉴权头
+	ContextWindow int                 `mapstructure:"context_window"` // 模型上下文窗口（token），prompt 组装时据此裁剪历史与检索片段
+	Generation    LLMGenerationConfig `mapstructure:"generation"`
+	Prompt        LLMPromptConfig     `mapstructure:"prompt"`
 }
 
 // LLMGenerationConfig 配置生成相关参数（可选）。
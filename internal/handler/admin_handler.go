@@ -128,7 +128,10 @@ func (h *AdminHandler) GetAllConversations(c *gin.Context) {
 		endTime = &t
 	}
 
-	conversations, err := h.adminService.GetAllConversations(c.Request.Context(), userID, startTime, endTime)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	conversations, err := h.adminService.GetAllConversations(c.Request.Context(), userID, startTime, endTime, page, size)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": err.Error(), "data": nil})
 		return
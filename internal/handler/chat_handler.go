@@ -3,8 +3,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"pai-smart-go/internal/repository"
 	"pai-smart-go/internal/service"
 	"pai-smart-go/pkg/log"
 	"pai-smart-go/pkg/token"
@@ -53,7 +55,16 @@ func (h *ChatHandler) GetWebsocketStopToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": gin.H{"cmdToken": h.stopToken}})
 }
 
+// chatRequest 是 WebSocket 上的 JSON 提问消息：{"type":"chat","content":"...","conversationId":"..."}。
+// 纯文本消息仍被视为提问内容，写入连接默认会话。
+type chatRequest struct {
+	Type           string `json:"type"`
+	Content        string `json:"content"`
+	ConversationID string `json:"conversationId"`
+}
+
 // Handle 处理一个传入的 WebSocket 连接。
+// 可通过查询参数 conversationId 指定本连接默认使用的会话，未指定时使用用户的当前会话。
 func (h *ChatHandler) Handle(c *gin.Context) {
 	tokenString := c.Param("token")
 	claims, err := h.jwtManager.VerifyToken(tokenString)
@@ -77,6 +88,7 @@ func (h *ChatHandler) Handle(c *gin.Context) {
 	defer conn.Close()
 
 	log.Infof("WebSocket 连接已建立，用户: %s", claims.Username)
+	defaultConversationID := c.Query("conversationId")
 
 	for {
 		_, message, err := conn.ReadMessage()
@@ -126,6 +138,18 @@ func (h *ChatHandler) Handle(c *gin.Context) {
 			continue
 		}
 
+		// 3) 提问：JSON 消息可携带会话 ID，纯文本消息使用连接默认会话
+		query, conversationID := string(message), defaultConversationID
+		if t, ok := ctrl["type"].(string); ok && t == "chat" {
+			var req chatRequest
+			if err := json.Unmarshal(message, &req); err == nil {
+				query = req.Content
+				if req.ConversationID != "" {
+					conversationID = req.ConversationID
+				}
+			}
+		}
+
 		// 调用 ChatService 处理完整的 RAG 和流式逻辑
 		shouldStop := func() bool {
 			key := sessionKey(conn)
@@ -134,7 +158,13 @@ func (h *ChatHandler) Handle(c *gin.Context) {
 		}
 		// 清除旧标志
 		h.stopFlags.Delete(sessionKey(conn))
-		err = h.chatService.StreamResponse(c.Request.Context(), string(message), user, conn, shouldStop)
+		err = h.chatService.StreamResponse(c.Request.Context(), conversationID, query, user, conn, shouldStop)
+		if errors.Is(err, repository.ErrConversationNotFound) {
+			errResp := map[string]string{"error": err.Error()}
+			b, _ := json.Marshal(errResp)
+			_ = conn.WriteMessage(websocket.TextMessage, b)
+			continue
+		}
 		if err != nil {
 			log.Errorf("处理流式响应失败: %v", err)
 			// 统一 JSON 错误
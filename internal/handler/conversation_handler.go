@@ -2,9 +2,12 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"pai-smart-go/internal/repository"
 	"pai-smart-go/internal/service"
+	"pai-smart-go/pkg/log"
 	"pai-smart-go/pkg/token"
 )
 
@@ -18,17 +21,27 @@ func NewConversationHandler(service service.ConversationService) *ConversationHa
 	return &ConversationHandler{service: service}
 }
 
-// GetConversations 处理获取用户对话历史的请求。
+// conversationTitleRequest 是新建与重命名会话的请求体。
+type conversationTitleRequest struct {
+	Title string `json:"title"`
+}
+
+// GetConversations 处理获取用户对话历史的请求，可通过 conversationId 查询参数指定会话。
 func (h *ConversationHandler) GetConversations(c *gin.Context) {
 	claims := c.MustGet("claims").(*token.CustomClaims)
+	h.respondHistory(c, claims.UserID, c.Query("conversationId"))
+}
 
-	history, err := h.service.GetConversationHistory(c.Request.Context(), claims.UserID)
+// GetConversationMessages 处理获取指定会话消息历史的请求。
+func (h *ConversationHandler) GetConversationMessages(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+	h.respondHistory(c, claims.UserID, c.Param("conversationId"))
+}
+
+func (h *ConversationHandler) respondHistory(c *gin.Context, userID uint, conversationID string) {
+	history, err := h.service.GetConversationHistory(c.Request.Context(), userID, conversationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    http.StatusInternalServerError,
-			"message": "Failed to retrieve conversation history",
-			"data":    nil,
-		})
+		h.respondError(c, err, "Failed to retrieve conversation history")
 		return
 	}
 
@@ -38,3 +51,87 @@ func (h *ConversationHandler) GetConversations(c *gin.Context) {
 		"data":    history,
 	})
 }
+
+// ListSessions 处理列出用户全部会话的请求。
+func (h *ConversationHandler) ListSessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+
+	sessions, err := h.service.ListConversations(c.Request.Context(), claims.UserID)
+	if err != nil {
+		h.respondError(c, err, "获取会话列表失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": sessions})
+}
+
+// CreateSession 处理新建会话的请求，新会话会成为当前会话。
+func (h *ConversationHandler) CreateSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+
+	var req conversationTitleRequest
+	// 请求体可省略，此时使用默认标题
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "message": "无效的请求参数", "data": nil})
+			return
+		}
+	}
+
+	session, err := h.service.CreateConversation(c.Request.Context(), claims.UserID, req.Title)
+	if err != nil {
+		h.respondError(c, err, "创建会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": session})
+}
+
+// SwitchSession 处理切换当前会话的请求。
+func (h *ConversationHandler) SwitchSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+
+	session, err := h.service.SwitchConversation(c.Request.Context(), claims.UserID, c.Param("conversationId"))
+	if err != nil {
+		h.respondError(c, err, "切换会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": session})
+}
+
+// RenameSession 处理重命名会话的请求。
+func (h *ConversationHandler) RenameSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+
+	var req conversationTitleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "message": "会话标题不能为空", "data": nil})
+		return
+	}
+
+	session, err := h.service.RenameConversation(c.Request.Context(), claims.UserID, c.Param("conversationId"), req.Title)
+	if err != nil {
+		h.respondError(c, err, "重命名会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": session})
+}
+
+// DeleteSession 处理删除会话的请求。
+func (h *ConversationHandler) DeleteSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*token.CustomClaims)
+
+	if err := h.service.DeleteConversation(c.Request.Context(), claims.UserID, c.Param("conversationId")); err != nil {
+		h.respondError(c, err, "删除会话失败")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "会话删除成功", "data": nil})
+}
+
+// respondError 将会话不存在映射为 404，其余错误记录日志并返回 500。
+func (h *ConversationHandler) respondError(c *gin.Context, err error, message string) {
+	if errors.Is(err, repository.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "message": err.Error(), "data": nil})
+		return
+	}
+	log.Errorf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": message, "data": nil})
+}
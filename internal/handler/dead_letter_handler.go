@@ -0,0 +1,62 @@
+// Package handler 包含了处理 HTTP 请求的控制器逻辑。
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"pai-smart-go/internal/repository"
+	"pai-smart-go/internal/service"
+	"pai-smart-go/pkg/log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetterHandler 负责处理管理员查看与重放死信任务的请求。
+type DeadLetterHandler struct {
+	deadLetterService service.DeadLetterService
+}
+
+// NewDeadLetterHandler 创建一个新的 DeadLetterHandler 实例。
+func NewDeadLetterHandler(deadLetterService service.DeadLetterService) *DeadLetterHandler {
+	return &DeadLetterHandler{deadLetterService: deadLetterService}
+}
+
+// ListDeadLetters 处理分页获取死信任务列表的请求。
+func (h *DeadLetterHandler) ListDeadLetters(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	list, err := h.deadLetterService.ListDeadLetters(c.Request.Context(), page, size)
+	if err != nil {
+		log.Error("ListDeadLetters: Failed to list dead letters", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": "获取死信任务列表失败", "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": list})
+}
+
+// GetDeadLetter 处理查看单个死信任务详情的请求。
+func (h *DeadLetterHandler) GetDeadLetter(c *gin.Context) {
+	deadLetter, err := h.deadLetterService.GetDeadLetter(c.Request.Context(), c.Param("id"))
+	h.respond(c, "success", deadLetter, err)
+}
+
+// ReplayDeadLetter 处理将死信任务重新投递到处理队列的请求。
+func (h *DeadLetterHandler) ReplayDeadLetter(c *gin.Context) {
+	deadLetter, err := h.deadLetterService.ReplayDeadLetter(c.Request.Context(), c.Param("id"))
+	h.respond(c, "死信任务已重新投递", deadLetter, err)
+}
+
+func (h *DeadLetterHandler) respond(c *gin.Context, message string, data interface{}, err error) {
+	if errors.Is(err, repository.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "message": err.Error(), "data": nil})
+		return
+	}
+	if err != nil {
+		log.Errorf("DeadLetter: request failed, id: %s, error: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": message, "data": data})
+}
@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"pai-smart-go/internal/model"
@@ -66,6 +67,51 @@ func (h *DocumentHandler) ListUploadedFiles(c *gin.Context) {
 	})
 }
 
+// GetProcessingStatus 处理查询文件处理进度的请求。
+func (h *DocumentHandler) GetProcessingStatus(c *gin.Context) {
+	fileMD5 := c.Param("fileMd5")
+	if fileMD5 == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少文件 MD5"})
+		return
+	}
+
+	claimsValue, _ := c.Get("claims")
+	claims := claimsValue.(*token.CustomClaims)
+
+	status, err := h.docService.GetProcessingStatus(fileMD5, claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "message": err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "获取文件处理状态成功",
+		"data":    status,
+	})
+}
+
+// ReprocessDocuments 处理管理员重新处理文档的请求，可按文件、用户、组织标签或失败状态选择范围。
+func (h *DocumentHandler) ReprocessDocuments(c *gin.Context) {
+	var req service.ReprocessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Warnf("ReprocessDocuments: Invalid request payload, error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "message": "无效的请求负载", "data": nil})
+		return
+	}
+
+	result, err := h.docService.ReprocessDocuments(c.Request.Context(), req)
+	if errors.Is(err, service.ErrEmptyReprocessScope) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "message": err.Error(), "data": nil})
+		return
+	}
+	if err != nil {
+		log.Error("ReprocessDocuments: failed", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": "重新处理文档失败", "data": nil})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"code": http.StatusAccepted, "message": "文档处理任务已重新入队", "data": result})
+}
+
 // DeleteDocument 处理删除文档的请求。
 func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 	fileMD5 := c.Param("fileMd5")
@@ -94,8 +140,10 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 
 // GenerateDownloadURL 处理生成文件下载链接的请求。
 func (h *DocumentHandler) GenerateDownloadURL(c *gin.Context) {
+	// fileMd5 可选，用于区分不同用户上传的同名文件
 	fileName := c.Query("fileName") // Changed from Param to Query
-	if fileName == "" {
+	fileMD5 := c.Query("fileMd5")
+	if fileName == "" && fileMD5 == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少文件名"})
 		return
 	}
@@ -106,7 +154,7 @@ func (h *DocumentHandler) GenerateDownloadURL(c *gin.Context) {
 		return
 	}
 
-	downloadInfo, err := h.docService.GenerateDownloadURL(fileName, user)
+	downloadInfo, err := h.docService.GenerateDownloadURL(fileName, fileMD5, user)
 	if err != nil {
 		log.Warnf("GenerateDownloadURL: failed for user %s, file %s, err: %v", user.Username, fileName, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -122,7 +170,8 @@ func (h *DocumentHandler) GenerateDownloadURL(c *gin.Context) {
 // PreviewFile 处理获取文件预览内容的请求。
 func (h *DocumentHandler) PreviewFile(c *gin.Context) {
 	fileName := c.Query("fileName")
-	if fileName == "" {
+	fileMD5 := c.Query("fileMd5")
+	if fileName == "" && fileMD5 == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少文件名"})
 		return
 	}
@@ -133,7 +182,7 @@ func (h *DocumentHandler) PreviewFile(c *gin.Context) {
 		return
 	}
 
-	previewInfo, err := h.docService.GetFilePreviewContent(fileName, user)
+	previewInfo, err := h.docService.GetFilePreviewContent(fileName, fileMD5, user)
 	if err != nil {
 		log.Warnf("PreviewFile: failed for user %s, file %s, err: %v", user.Username, fileName, err)
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
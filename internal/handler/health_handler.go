@@ -0,0 +1,36 @@
+// Package handler 包含了处理 HTTP 请求的控制器逻辑。
+package handler
+
+import (
+	"net/http"
+	"pai-smart-go/pkg/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConsumerHealthReporter 提供 Kafka 消费者及其工作协程的运行状况。
+type ConsumerHealthReporter interface {
+	Health() kafka.ConsumerHealth
+}
+
+// HealthHandler 负责处理后台任务运行状况的查询请求。
+type HealthHandler struct {
+	consumer ConsumerHealthReporter
+}
+
+// NewHealthHandler 创建一个新的 HealthHandler 实例。
+func NewHealthHandler(consumer ConsumerHealthReporter) *HealthHandler {
+	return &HealthHandler{consumer: consumer}
+}
+
+// GetKafkaWorkers 返回文件处理消费者各主题及工作协程的状态；存在未连接的主题时返回 503。
+func (h *HealthHandler) GetKafkaWorkers(c *gin.Context) {
+	health := h.consumer.Health()
+	status := http.StatusOK
+	message := "success"
+	if !health.Healthy {
+		status = http.StatusServiceUnavailable
+		message = "Kafka 消费者未连接"
+	}
+	c.JSON(status, gin.H{"code": status, "message": message, "data": health})
+}
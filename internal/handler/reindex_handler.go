@@ -0,0 +1,71 @@
+// Package handler 包含了处理 HTTP 请求的控制器逻辑。
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"pai-smart-go/internal/repository"
+	"pai-smart-go/internal/service"
+	"pai-smart-go/pkg/log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReindexHandler 负责处理管理员触发与查询重建向量索引任务的请求。
+type ReindexHandler struct {
+	reindexService service.ReindexService
+}
+
+// NewReindexHandler 创建一个新的 ReindexHandler 实例。
+func NewReindexHandler(reindexService service.ReindexService) *ReindexHandler {
+	return &ReindexHandler{reindexService: reindexService}
+}
+
+// StartReindex 处理启动重建索引任务的请求。请求体可省略，此时以当前模型重建。
+func (h *ReindexHandler) StartReindex(c *gin.Context) {
+	var req service.ReindexRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Warnf("StartReindex: Invalid request payload, error: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"code": http.StatusBadRequest, "message": "无效的请求负载", "data": nil})
+			return
+		}
+	}
+
+	job, err := h.reindexService.StartReindex(c.Request.Context(), req)
+	if errors.Is(err, service.ErrReindexRunning) {
+		c.JSON(http.StatusConflict, gin.H{"code": http.StatusConflict, "message": err.Error(), "data": nil})
+		return
+	}
+	if err != nil {
+		log.Errorf("StartReindex: failed to start reindex job, error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"code": http.StatusAccepted, "message": "重建索引任务已启动", "data": job})
+}
+
+// GetReindexJob 处理查询指定重建索引任务进度的请求。
+func (h *ReindexHandler) GetReindexJob(c *gin.Context) {
+	job, err := h.reindexService.GetReindexJob(c.Request.Context(), c.Param("jobId"))
+	h.respondJob(c, job, err)
+}
+
+// GetLatestReindexJob 处理查询最近一次重建索引任务进度的请求。
+func (h *ReindexHandler) GetLatestReindexJob(c *gin.Context) {
+	job, err := h.reindexService.GetLatestReindexJob(c.Request.Context())
+	h.respondJob(c, job, err)
+}
+
+func (h *ReindexHandler) respondJob(c *gin.Context, job interface{}, err error) {
+	if errors.Is(err, repository.ErrReindexJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": http.StatusNotFound, "message": err.Error(), "data": nil})
+		return
+	}
+	if err != nil {
+		log.Errorf("GetReindexJob: failed to get reindex job, error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": job})
+}
@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/internal/service"
 	"pai-smart-go/pkg/log"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,7 +41,13 @@ func (h *SearchHandler) HybridSearch(c *gin.Context) {
 	if err != nil || topK <= 0 {
 		topK = 10
 	}
-	log.Infof("[SearchHandler] 解析参数, topK: %d", topK)
+	opts, err := parseSearchOptions(c)
+	if err != nil {
+		log.Warnf("[SearchHandler] 搜索请求失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Infof("[SearchHandler] 解析参数, topK: %d, fusion: %s", topK, opts.Fusion)
 
 	user, exists := c.Get("user")
 	if !exists {
@@ -46,13 +56,123 @@ func (h *SearchHandler) HybridSearch(c *gin.Context) {
 		return
 	}
 
-	results, err := h.searchService.HybridSearch(c.Request.Context(), query, topK, user.(*model.User))
+	result, err := h.searchService.HybridSearch(c.Request.Context(), query, topK, user.(*model.User), opts)
+	if errors.Is(err, service.ErrInvalidSearchOptions) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Errorf("[SearchHandler] 混合搜索服务返回错误, error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索失败"})
 		return
 	}
 
-	log.Infof("[SearchHandler] 混合搜索成功, query: '%s', 返回 %d 条结果", query, len(results))
-	c.JSON(http.StatusOK, gin.H{"code": 200, "data": results, "message": "success"})
+	log.Infof("[SearchHandler] 混合搜索成功, query: '%s', 返回 %d 条结果", query, len(result.Results))
+	resp := gin.H{"code": 200, "data": result.Results, "message": "success"}
+	if result.Facets != nil {
+		resp["facets"] = result.Facets
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseSearchOptions 解析可选的排序参数 fusion、knnWeight、bm25Weight、rrfK 与 rerank，未提供的沿用配置，
+// 以及过滤参数与 facets 开关。
+func parseSearchOptions(c *gin.Context) (service.SearchOptions, error) {
+	opts := service.SearchOptions{Fusion: c.Query("fusion")}
+	parseWeight := func(name string) (*float64, error) {
+		raw := c.Query(name)
+		if raw == "" {
+			return nil, nil
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的参数 %s: %s", name, raw)
+		}
+		return &v, nil
+	}
+	var err error
+	if opts.KNNWeight, err = parseWeight("knnWeight"); err != nil {
+		return opts, err
+	}
+	if opts.BM25Weight, err = parseWeight("bm25Weight"); err != nil {
+		return opts, err
+	}
+	if raw := c.Query("rerank"); raw != "" {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("无效的参数 rerank: %s", raw)
+		}
+		opts.DisableRerank = !enabled
+	}
+	if raw := c.Query("rrfK"); raw != "" {
+		if opts.RRFK, err = strconv.Atoi(raw); err != nil {
+			return opts, fmt.Errorf("无效的参数 rrfK: %s", raw)
+		}
+	}
+	if raw := c.Query("facets"); raw != "" {
+		if opts.Facets, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("无效的参数 facets: %s", raw)
+		}
+	}
+	opts.Filters, err = parseSearchFilters(c)
+	return opts, err
+}
+
+// parseSearchFilters 解析过滤参数 fileMd5、orgTag、userId、fileType、uploadedFrom 与 uploadedTo。
+// 多值参数既可重复传递，也可用逗号分隔；日期接受 RFC3339 或 2006-01-02，仅有日期的 uploadedTo 包含当天。
+func parseSearchFilters(c *gin.Context) (service.SearchFilters, error) {
+	filters := service.SearchFilters{
+		FileMD5s: queryList(c, "fileMd5"),
+		OrgTags:  queryList(c, "orgTag"),
+	}
+	for _, raw := range queryList(c, "userId") {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return filters, fmt.Errorf("无效的参数 userId: %s", raw)
+		}
+		filters.UserIDs = append(filters.UserIDs, uint(id))
+	}
+	for _, raw := range queryList(c, "fileType") {
+		filters.FileTypes = append(filters.FileTypes, strings.TrimPrefix(strings.ToLower(raw), "."))
+	}
+	var err error
+	if filters.UploadedFrom, err = parseQueryTime(c, "uploadedFrom", false); err != nil {
+		return filters, err
+	}
+	if filters.UploadedTo, err = parseQueryTime(c, "uploadedTo", true); err != nil {
+		return filters, err
+	}
+	return filters, nil
+}
+
+// queryList 读取多值查询参数，支持重复参数与逗号分隔，忽略空值。
+func queryList(c *gin.Context, name string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(name) {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parseQueryTime 解析时间查询参数。endOfDay 为 true 时，仅有日期的值取当天的最后时刻。
+func parseQueryTime(c *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("无效的参数 %s: %s", name, raw)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &t, nil
 }
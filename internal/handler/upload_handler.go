@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"pai-smart-go/internal/service"
@@ -29,8 +30,19 @@ func NewUploadHandler(uploadService service.UploadService) *UploadHandler {
 }
 
 // CheckFileRequest 定义了文件秒传检查 API 的请求体结构。
+// FileName、OrgTag、IsPublic 可选，复用其他用户已上传的相同文件时用于创建当前用户的记录。
+// Proof 是对上一次响应中 challenge 的应答：文件中该字节范围的 SHA-256（十六进制）。
 type CheckFileRequest struct {
-	MD5 string `json:"md5" binding:"required"`
+	MD5      string `json:"md5" binding:"required"`
+	FileName string `json:"fileName"`
+	OrgTag   string `json:"orgTag"`
+	IsPublic bool   `json:"isPublic"`
+	Proof    string `json:"proof"`
+}
+
+// instantUploadOptions 提取秒传时新建记录所需的元数据。
+func (r CheckFileRequest) instantUploadOptions() service.InstantUploadOptions {
+	return service.InstantUploadOptions{FileName: r.FileName, OrgTag: r.OrgTag, IsPublic: r.IsPublic, Proof: r.Proof}
 }
 
 // CheckFile 处理文件秒传检查的请求。
@@ -45,17 +57,25 @@ func (h *UploadHandler) CheckFile(c *gin.Context) {
 	userClaims := claimsValue.(*token.CustomClaims)
 	userID := userClaims.UserID
 
-	completed, uploadedChunks, err := h.uploadService.CheckFile(c.Request.Context(), req.MD5, userID)
+	result, err := h.uploadService.CheckFile(c.Request.Context(), req.MD5, userID, req.instantUploadOptions())
+	if errors.Is(err, service.ErrPossessionProofInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Error("CheckFile: failed to check file", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器内部错误"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"completed":      completed,
-		"uploadedChunks": uploadedChunks,
-	})
+	resp := gin.H{
+		"completed":      result.Completed,
+		"uploadedChunks": result.UploadedChunks,
+	}
+	if result.Challenge != nil {
+		resp["challenge"] = result.Challenge
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // UploadChunk 处理分片上传的请求。
@@ -67,6 +87,7 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 	chunkIndexStr := c.PostForm("chunkIndex")
 	orgTag := c.PostForm("orgTag")
 	isPublicStr := c.PostForm("isPublic") // "true" or "false"
+	chunkMD5 := c.PostForm("chunkMd5")    // 可选，提供时服务端校验分片内容
 
 	if fileMD5 == "" || fileName == "" || totalSizeStr == "" || chunkIndexStr == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少必要的参数"})
@@ -97,7 +118,15 @@ func (h *UploadHandler) UploadChunk(c *gin.Context) {
 	userClaims := claims.(*token.CustomClaims)
 	userID := userClaims.UserID
 
-	uploadedChunks, totalChunks, err := h.uploadService.UploadChunk(c.Request.Context(), fileMD5, fileName, totalSize, chunkIndex, file, userID, orgTag, isPublic)
+	uploadedChunks, totalChunks, err := h.uploadService.UploadChunk(c.Request.Context(), fileMD5, fileName, totalSize, chunkIndex, chunkMD5, file, userID, orgTag, isPublic)
+	if errors.Is(err, service.ErrChunkChecksumMismatch) {
+		log.Warnf("UploadChunk: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		log.Error("UploadChunk: failed to upload chunk", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -139,6 +168,14 @@ func (h *UploadHandler) MergeChunks(c *gin.Context) {
 	userID := userClaims.UserID
 
 	objectURL, err := h.uploadService.MergeChunks(c.Request.Context(), req.MD5, req.FileName, userID)
+	if errors.Is(err, service.ErrFileChecksumMismatch) {
+		log.Warnf("MergeChunks: %v", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"code":    http.StatusUnprocessableEntity,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		log.Error("MergeChunks: failed to merge chunks", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "文件合并失败: " + err.Error()})
@@ -210,9 +247,7 @@ func (h *UploadHandler) GetSupportedFileTypes(c *gin.Context) {
 
 // FastUpload handles the fast upload check request.
 func (h *UploadHandler) FastUpload(c *gin.Context) {
-	var req struct {
-		MD5 string `json:"md5"`
-	}
+	var req CheckFileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
@@ -220,11 +255,30 @@ func (h *UploadHandler) FastUpload(c *gin.Context) {
 
 	claims := c.MustGet("claims").(*token.CustomClaims)
 
-	isUploaded, err := h.uploadService.FastUpload(c.Request.Context(), req.MD5, claims.UserID)
+	result, err := h.uploadService.FastUpload(c.Request.Context(), req.MD5, claims.UserID, req.instantUploadOptions())
+	if errors.Is(err, service.ErrPossessionProofInvalid) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check file status"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"uploaded": isUploaded})
+	resp := gin.H{"uploaded": result.Completed}
+	if result.Challenge != nil {
+		resp["challenge"] = result.Challenge
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetStaleUploads 处理管理员查询过期未完成上传的请求（试运行，不做任何删除）。
+func (h *UploadHandler) GetStaleUploads(c *gin.Context) {
+	report, err := h.uploadService.GetStaleUploadReport(c.Request.Context())
+	if err != nil {
+		log.Errorf("GetStaleUploads: failed to build stale upload report, error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "message": err.Error(), "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "message": "success", "data": report})
 }
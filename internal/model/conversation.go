@@ -5,20 +5,47 @@ import "time"
 
 // ChatMessage 代表存储在 Redis 中的单条对话消息。
 type ChatMessage struct {
-	Role      string    `json:"role"` // "user" 或 "assistant"
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
+	Role      string               `json:"role"` // "user" 或 "assistant"
+	Content   string               `json:"content"`
+	Sources   []ConversationSource `json:"sources,omitempty"` // 仅 assistant 消息携带，对应回答中的 [n] 引用
+	Timestamp time.Time            `json:"timestamp"`
 }
 
-// Conversation 代表一次单独的问答交互。
+// Conversation 代表一次单独的问答交互，持久化在 MySQL 中作为完整、永久的对话记录。
 type Conversation struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"index;not null" json:"userId"`
-	Question  string    `gorm:"type:text;not null" json:"question"`
-	Answer    string    `gorm:"type:text;not null" json:"answer"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	ID             uint                 `gorm:"primaryKey" json:"id"`
+	UserID         uint                 `gorm:"index;not null" json:"userId"`
+	ConversationID string               `gorm:"type:varchar(64);index;not null" json:"conversationId"`
+	Question       string               `gorm:"type:text;not null" json:"question"`
+	Answer         string               `gorm:"type:text;not null" json:"answer"`
+	Sources        []ConversationSource `gorm:"type:json;serializer:json" json:"sources"`
+	CreatedAt      time.Time            `gorm:"autoCreateTime;index" json:"createdAt"`
 }
 
 func (Conversation) TableName() string {
 	return "conversations"
 }
+
+// ConversationSession 描述用户的一个对话会话（一组连续的问答），持久化在 MySQL 中。
+type ConversationSession struct {
+	ID        string    `gorm:"column:conversation_id;type:varchar(64);primaryKey" json:"conversationId"`
+	UserID    uint      `gorm:"not null" json:"userId"`
+	Title     string    `gorm:"type:varchar(255);not null" json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (ConversationSession) TableName() string {
+	return "conversation_sessions"
+}
+
+// ConversationSource 记录一轮问答中检索到并提供给模型的文档分块。
+// Index 与 prompt 中的引用编号 [n] 一致，前端据此将回答中的引用渲染为可点击的链接。
+type ConversationSource struct {
+	Index    int     `json:"index"`
+	FileMD5  string  `json:"fileMd5"`
+	FileName string  `json:"fileName"`
+	ChunkID  int     `json:"chunkId"`
+	Score    float64 `json:"score"`
+	Snippet  string  `json:"snippet"`
+}
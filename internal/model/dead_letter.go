@@ -0,0 +1,17 @@
+package model
+
+import (
+	"pai-smart-go/pkg/tasks"
+	"time"
+)
+
+// DeadLetter 记录一个重试耗尽后进入死信主题的文件处理任务，保存在 Redis 中供管理员查看与重放。
+type DeadLetter struct {
+	ID          string                   `json:"id"`
+	Task        tasks.FileProcessingTask `json:"task"`
+	Error       string                   `json:"error"`
+	Attempts    int                      `json:"attempts"`
+	FailedAt    time.Time                `json:"failedAt"`
+	ReplayCount int                      `json:"replayCount"`
+	ReplayedAt  *time.Time               `json:"replayedAt,omitempty"`
+}
@@ -1,16 +1,29 @@
 // Package model 定义了与数据库表对应的 Go 结构体。
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
 // SearchResponseDTO 定义了返回给前端的搜索结果结构。
 type SearchResponseDTO struct {
 	FileMD5     string  `json:"fileMd5"`
 	FileName    string  `json:"fileName"` // 新增：原始文件名
 	ChunkID     int     `json:"chunkId"`
 	TextContent string  `json:"textContent"`
-	Score       float64 `json:"score"` // 新增：搜索得分
+	Score       float64 `json:"score"` // 最终得分：启用重排序时为重排序分数，否则为召回分数
 	UserID      string  `json:"userId"`
 	OrgTag      string  `json:"orgTag"`
 	IsPublic    bool    `json:"isPublic"`
+	// RetrievalScore 是混合检索按所用融合策略给出的召回分数
+	RetrievalScore float64 `json:"retrievalScore"`
+	// RerankScore 是重排序模型给出的相关性分数，未经重排序时为空
+	RerankScore *float64 `json:"rerankScore,omitempty"`
+	// Highlights 是 BM25 命中的高亮片段，仅由向量检索召回的分块没有片段
+	Highlights []string `json:"highlights,omitempty"`
 }
 
 // EsDocument 代表存储在 Elasticsearch 中的文档结构。
@@ -22,7 +35,134 @@ type EsDocument struct {
 	TextContent  string    `json:"text_content"`
 	Vector       []float32 `json:"vector"` // 文本内容的向量表示
 	ModelVersion string    `json:"model_version"`
-	UserID       uint      `json:"user_id"`
-	OrgTag       string    `json:"org_tag"`
-	IsPublic     bool      `json:"is_public"`
+	// 同一内容可被多个用户秒传共享，user_id 与 org_tag 以数组保存全部所有者，
+	// 任一所有者公开时 is_public 为 true。检索过滤条件为“或”关系，合并后的权限与逐个所有者判断一致。
+	UserID   UintList   `json:"user_id"`
+	OrgTag   StringList `json:"org_tag"`
+	IsPublic bool       `json:"is_public"`
+	// FileType 是小写、不带点的扩展名，UploadedAt 是该内容首次上传完成的时间，用于检索过滤
+	FileType   string     `json:"file_type,omitempty"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
+}
+
+// FacetBucket 是一个分面取值及其命中的分块数。
+type FacetBucket struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"` // 可读名称，如文件名
+	Count int64  `json:"count"`
+}
+
+// SearchFacets 是检索命中分块按文件与组织标签的分面统计。
+type SearchFacets struct {
+	Files   []FacetBucket `json:"files"`
+	OrgTags []FacetBucket `json:"orgTags"`
+}
+
+// UintList 是可同时解析单个数值与数组的 ID 列表，兼容单所有者时期写入的文档。
+type UintList []uint
+
+// UnmarshalJSON 实现 json.Unmarshaler。
+func (l *UintList) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]uint)(l))
+	}
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var v uint
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*l = UintList{v}
+	return nil
+}
+
+// StringList 是可同时解析单个字符串与数组的字符串列表，兼容单所有者时期写入的文档。
+type StringList []string
+
+// UnmarshalJSON 实现 json.Unmarshaler。
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]string)(l))
+	}
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*l = StringList{v}
+	return nil
+}
+
+// DocumentOwners 是共享同一文件内容（相同 file_md5）的全部已完成上传记录的所有者集合，
+// 以及取自其中最早一条记录的文件类型与上传时间。
+type DocumentOwners struct {
+	UserIDs    UintList
+	OrgTags    StringList
+	IsPublic   bool
+	FileType   string
+	UploadedAt *time.Time
+}
+
+// Empty 报告是否已没有任何所有者。
+func (o DocumentOwners) Empty() bool {
+	return len(o.UserIDs) == 0
+}
+
+// Equal 报告两个所有者集合是否相同（二者均由 GroupOwners 生成，顺序稳定）。
+func (o DocumentOwners) Equal(other DocumentOwners) bool {
+	return o.IsPublic == other.IsPublic &&
+		fmt.Sprint(o.UserIDs) == fmt.Sprint(other.UserIDs) &&
+		fmt.Sprint(o.OrgTags) == fmt.Sprint(other.OrgTags)
+}
+
+// GroupOwners 按 file_md5 汇总已完成上传（status=1）记录的所有者，结果按用户 ID 与组织标签排序。
+func GroupOwners(files []*FileUpload) map[string]DocumentOwners {
+	owners := make(map[string]DocumentOwners)
+	for _, f := range files {
+		if f.Status != 1 {
+			continue
+		}
+		o := owners[f.FileMD5]
+		if !containsUint(o.UserIDs, f.UserID) {
+			o.UserIDs = append(o.UserIDs, f.UserID)
+		}
+		if f.OrgTag != "" && !containsString(o.OrgTags, f.OrgTag) {
+			o.OrgTags = append(o.OrgTags, f.OrgTag)
+		}
+		o.IsPublic = o.IsPublic || f.IsPublic
+		if uploadedAt := f.UploadedAt(); o.UploadedAt == nil || uploadedAt.Before(*o.UploadedAt) {
+			o.UploadedAt = &uploadedAt
+			o.FileType = f.Extension()
+		}
+		owners[f.FileMD5] = o
+	}
+	for md5, o := range owners {
+		sort.Slice(o.UserIDs, func(i, j int) bool { return o.UserIDs[i] < o.UserIDs[j] })
+		sort.Strings(o.OrgTags)
+		owners[md5] = o
+	}
+	return owners
+}
+
+func containsUint(list []uint, v uint) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
 }
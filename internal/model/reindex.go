@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// 重建索引任务的状态。
+const (
+	ReindexStatusRunning   = "running"
+	ReindexStatusSucceeded = "succeeded"
+	ReindexStatusFailed    = "failed"
+)
+
+// ReindexJob 记录一次用新 embedding 模型重建向量索引的任务及其进度，保存在 Redis 中。
+type ReindexJob struct {
+	JobID         string     `json:"jobId"`
+	Status        string     `json:"status"`
+	Alias         string     `json:"alias"`
+	SourceIndices []string   `json:"sourceIndices"`
+	TargetIndex   string     `json:"targetIndex"`
+	Model         string     `json:"model"`
+	Dimensions    int        `json:"dimensions"`
+	Total         int64      `json:"total"`
+	Processed     int64      `json:"processed"`
+	Error         string     `json:"error,omitempty"`
+	StartedAt     time.Time  `json:"startedAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+}
@@ -1,7 +1,12 @@
 // Package model 定义了与数据库表对应的 Go 结构体。
 package model
 
-import "time"
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 // FileUpload 定义了 file_upload 表的 ORM 模型。
 // 它记录了每个上传文件的元数据和状态。
@@ -16,6 +21,77 @@ type FileUpload struct {
 	IsPublic  bool       `gorm:"not null;default:false" json:"isPublic"`
 	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
 	MergedAt  *time.Time `gorm:"default:null" json:"mergedAt"`
+	// ObjectKey 是合并后文件在 MinIO 中的对象键，见 MergedObjectKey
+	ObjectKey string `gorm:"type:varchar(255);not null;default:''" json:"-"`
+	// LastChunkAt 是最后一次上传分片的时间，未完成的上传据此判断是否过期
+	LastChunkAt *time.Time `gorm:"default:null" json:"lastChunkAt"`
+
+	// 合并后的处理进度，由 MergeChunks 置为 queued，之后由 pipeline.Processor 推进。
+	ProcessingStatus    string     `gorm:"type:varchar(20);not null;default:''" json:"processingStatus"`
+	ChunkCount          int        `gorm:"not null;default:0" json:"chunkCount"`
+	IndexedCount        int        `gorm:"not null;default:0" json:"indexedCount"`
+	ProcessingError     string     `gorm:"type:text" json:"processingError"`
+	ProcessingUpdatedAt *time.Time `gorm:"default:null" json:"processingUpdatedAt"`
+}
+
+// MergedObjectKey 返回合并后文件的对象键。键由用户与文件 MD5 决定，
+// 不同用户上传的同名文件互不覆盖，删除一方的文件也不会影响另一方。
+func MergedObjectKey(userID uint, fileMD5 string) string {
+	return fmt.Sprintf("merged/%d/%s", userID, fileMD5)
+}
+
+// LegacyMergedObjectKey 返回旧版本按文件名保存合并文件的对象键，仅用于兼容尚未迁移的记录。
+func LegacyMergedObjectKey(fileName string) string {
+	return fmt.Sprintf("merged/%s", fileName)
+}
+
+// StorageKey 返回文件实际所在的对象键，尚未迁移的旧记录回退到按文件名的旧路径。
+func (f FileUpload) StorageKey() string {
+	if f.ObjectKey != "" {
+		return f.ObjectKey
+	}
+	return LegacyMergedObjectKey(f.FileName)
+}
+
+// 文件处理状态依次为 queued -> extracting -> chunking -> embedding -> indexing -> ready，
+// 任一阶段出错则进入 failed；重试时从 extracting 重新开始。
+const (
+	ProcessingStatusQueued     = "queued"
+	ProcessingStatusExtracting = "extracting"
+	ProcessingStatusChunking   = "chunking"
+	ProcessingStatusEmbedding  = "embedding"
+	ProcessingStatusIndexing   = "indexing"
+	ProcessingStatusReady      = "ready"
+	ProcessingStatusFailed     = "failed"
+)
+
+// ProcessingState 是一次处理进度更新写入 file_upload 的字段。
+type ProcessingState struct {
+	Status       string
+	ChunkCount   int
+	IndexedCount int
+	Error        string
+}
+
+// LastActivityAt 返回上传最后一次活动的时间，尚未上传任何分片时为记录的创建时间。
+func (f FileUpload) LastActivityAt() time.Time {
+	if f.LastChunkAt != nil {
+		return *f.LastChunkAt
+	}
+	return f.CreatedAt
+}
+
+// UploadedAt 返回上传完成（合并）的时间，旧记录没有合并时间时为创建时间。
+func (f FileUpload) UploadedAt() time.Time {
+	if f.MergedAt != nil {
+		return *f.MergedAt
+	}
+	return f.CreatedAt
+}
+
+// Extension 返回小写、不带点的文件扩展名，没有扩展名时为空。
+func (f FileUpload) Extension() string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(f.FileName)), ".")
 }
 
 // TableName 指定了此模型在数据库中对应的表名。
@@ -37,3 +113,24 @@ type ChunkInfo struct {
 func (ChunkInfo) TableName() string {
 	return "chunk_info"
 }
+
+// DocumentDeletion 记录一次尚未完全完成的文档删除。
+// 删除开始前写入 Redis，MySQL、Elasticsearch、MinIO 全部清理成功后移除；
+// 中途失败的记录由后台对账任务重试。
+type DocumentDeletion struct {
+	FileMD5    string    `json:"fileMd5"`
+	UserID     uint      `json:"userId"`
+	ObjectName string    `json:"objectName"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"lastError"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// PossessionChallenge 是跨用户秒传时要求客户端证明持有文件内容的挑战：
+// 客户端需提交文件 [Offset, Offset+Length) 字节的 SHA-256（十六进制）。
+// 挑战由服务端随机选取并保存在 Redis 中，只能使用一次。
+type PossessionChallenge struct {
+	Offset    int64     `json:"offset"`
+	Length    int64     `json:"length"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
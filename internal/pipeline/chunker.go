@@ -0,0 +1,220 @@
+package pipeline
+
+import (
+	"pai-smart-go/internal/config"
+	"pai-smart-go/pkg/tokenizer"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// 未配置切块参数时的默认值（recursive 策略下以 token 计）。
+	defaultChunkSize    = 800
+	defaultChunkOverlap = 100
+
+	strategyRecursive = "recursive"
+	strategyFixed     = "fixed"
+)
+
+// Chunker 定义了将长文本切分为分块的策略。
+type Chunker interface {
+	Split(text string) []string
+}
+
+// NewChunker 根据配置创建切块器。未配置或无法识别的策略使用 recursive。
+func NewChunker(cfg config.ChunkStrategyConfig) Chunker {
+	size := cfg.ChunkSize
+	overlap := cfg.ChunkOverlap
+	if size <= 0 {
+		size = defaultChunkSize
+		overlap = defaultChunkOverlap
+	}
+	// 重叠不小于分块大小时无法推进，退化为无重叠切分
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	if cfg.Strategy == strategyFixed {
+		return &fixedChunker{chunkSize: size, chunkOverlap: overlap}
+	}
+	return &recursiveChunker{chunkSize: size, chunkOverlap: overlap, boundaries: defaultBoundaries}
+}
+
+// fixedChunker 按固定的字符窗口切分文本，是最早期的切块方式。
+type fixedChunker struct {
+	chunkSize    int
+	chunkOverlap int
+}
+
+// Split 将长文本按指定大小和重叠进行切分。
+func (c *fixedChunker) Split(text string) []string {
+	var chunks []string
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+
+	step := c.chunkSize - c.chunkOverlap
+	for i := 0; i < len(runes); i += step {
+		end := i + c.chunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[i:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
+
+// boundary 描述一种文本结构边界。
+type boundary struct {
+	re *regexp.Regexp
+	// before 为 true 时在匹配处之前切分（如标题行），否则在匹配之后切分（如句末标点）。
+	before bool
+}
+
+// defaultBoundaries 按粒度从粗到细排列：标题、段落、换行、句子、分句、空白。
+var defaultBoundaries = []boundary{
+	{re: regexp.MustCompile(`(?m)^[ \t]*(?:#{1,6}\s|第[0-9一二三四五六七八九十百千]+[章节部分篇]|[一二三四五六七八九十]+、)`), before: true},
+	{re: regexp.MustCompile(`\n[ \t]*\n\s*`)},
+	{re: regexp.MustCompile(`\n`)},
+	{re: regexp.MustCompile(`[。！？!?；;…]+[”’"」』）)]*|\.(?:\s+|$)`)},
+	{re: regexp.MustCompile(`[，,、：:]`)},
+	{re: regexp.MustCompile(`\s+`)},
+}
+
+// cut 在所有匹配位置把文本切成若干片段，片段拼接后与原文一致。
+func (b boundary) cut(text string) []string {
+	var pieces []string
+	start := 0
+	for _, loc := range b.re.FindAllStringIndex(text, -1) {
+		pos := loc[1]
+		if b.before {
+			pos = loc[0]
+		}
+		if pos > start {
+			pieces = append(pieces, text[start:pos])
+			start = pos
+		}
+	}
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
+
+// recursiveChunker 优先在较粗的结构边界处切分，只有当片段仍超过 token 上限时，
+// 才退到更细的边界，最后才按 token 硬切，从而尽量避免把句子、表格行和标题拆开。
+type recursiveChunker struct {
+	chunkSize    int
+	chunkOverlap int
+	boundaries   []boundary
+}
+
+// Split 按结构边界递归切分文本，每个分块的 token 数不超过 chunkSize。
+func (c *recursiveChunker) Split(text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	return c.split(text, 0)
+}
+
+func (c *recursiveChunker) split(text string, level int) []string {
+	if tokenizer.Count(text) <= c.chunkSize {
+		if s := strings.TrimSpace(text); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+	if level >= len(c.boundaries) {
+		return splitByTokens(text, c.chunkSize, c.chunkOverlap)
+	}
+	pieces := c.boundaries[level].cut(text)
+	if len(pieces) <= 1 {
+		return c.split(text, level+1)
+	}
+	return c.merge(pieces, level)
+}
+
+// merge 把同一层级的片段贪心地合并为不超过 chunkSize 的分块，
+// 并在相邻分块之间保留不超过 chunkOverlap 的尾部片段作为重叠。
+func (c *recursiveChunker) merge(pieces []string, level int) []string {
+	var chunks []string
+	var window []string
+	var windowCounts []int
+	windowTokens := 0
+	pending := false // 窗口中是否有尚未输出的新片段
+
+	emit := func() {
+		if !pending {
+			return
+		}
+		if s := strings.TrimSpace(strings.Join(window, "")); s != "" {
+			chunks = append(chunks, s)
+		}
+		pending = false
+	}
+	shrink := func(limit int) {
+		for len(window) > 0 && windowTokens > limit {
+			windowTokens -= windowCounts[0]
+			window, windowCounts = window[1:], windowCounts[1:]
+		}
+	}
+
+	for _, p := range pieces {
+		n := tokenizer.Count(p)
+		if n > c.chunkSize {
+			// 片段本身过大：窗口中较短的未输出内容（通常是标题）并入该片段，
+			// 其余情况先输出窗口，再在更细的边界上递归切分
+			if pending && windowTokens <= c.chunkOverlap {
+				p = strings.Join(window, "") + p
+			} else {
+				emit()
+			}
+			window, windowCounts, windowTokens, pending = nil, nil, 0, false
+			chunks = append(chunks, c.split(p, level+1)...)
+			continue
+		}
+		if windowTokens+n > c.chunkSize {
+			emit()
+			shrink(c.chunkOverlap)
+			shrink(c.chunkSize - n)
+		}
+		window = append(window, p)
+		windowCounts = append(windowCounts, n)
+		windowTokens += n
+		pending = true
+	}
+	emit()
+	return chunks
+}
+
+// splitByTokens 在没有可用结构边界时，按 token 上限硬切文本。
+func splitByTokens(text string, chunkSize, chunkOverlap int) []string {
+	var chunks []string
+	for text != "" {
+		head := tokenizer.Truncate(text, chunkSize)
+		if head == "" {
+			_, w := utf8.DecodeRuneInString(text)
+			head = text[:w]
+		}
+		if s := strings.TrimSpace(head); s != "" {
+			chunks = append(chunks, s)
+		}
+		if len(head) == len(text) {
+			break
+		}
+		next := len(head)
+		if chunkOverlap > 0 {
+			if keep := tokenizer.Truncate(head, tokenizer.Count(head)-chunkOverlap); keep != "" {
+				next = len(keep)
+			}
+		}
+		text = text[next:]
+	}
+	return chunks
+}
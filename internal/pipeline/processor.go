@@ -14,11 +14,21 @@ import (
 	"pai-smart-go/pkg/storage"
 	"pai-smart-go/pkg/tasks"
 	"pai-smart-go/pkg/tika"
+	"sync"
 	"unicode/utf8"
 
 	"github.com/minio/minio-go/v7"
 )
 
+// errNoOwners 表示处理期间该文件的全部记录已被删除，不再有可以归属的所有者。
+var errNoOwners = errors.New("文件记录已删除, 放弃索引")
+
+const (
+	// 未配置 embedding.batch_size / embedding.concurrency 时的默认值。
+	defaultEmbeddingBatchSize   = 10
+	defaultEmbeddingConcurrency = 4
+)
+
 // Processor 封装了文件处理的所有依赖和逻辑。
 type Processor struct {
 	tikaClient      *tika.Client
@@ -26,6 +36,7 @@ type Processor struct {
 	esCfg           config.ElasticsearchConfig
 	minioCfg        config.MinIOConfig
 	embeddingCfg    config.EmbeddingConfig
+	chunkingCfg     config.ChunkingConfig
 	uploadRepo      repository.UploadRepository
 	docVectorRepo   repository.DocumentVectorRepository
 }
@@ -37,6 +48,7 @@ func NewProcessor(
 	esCfg config.ElasticsearchConfig,
 	minioCfg config.MinIOConfig,
 	embeddingCfg config.EmbeddingConfig,
+	chunkingCfg config.ChunkingConfig,
 	uploadRepo repository.UploadRepository,
 	docVectorRepo repository.DocumentVectorRepository,
 ) *Processor {
@@ -46,17 +58,47 @@ func NewProcessor(
 		esCfg:           esCfg,
 		minioCfg:        minioCfg,
 		embeddingCfg:    embeddingCfg,
+		chunkingCfg:     chunkingCfg,
 		uploadRepo:      uploadRepo,
 		docVectorRepo:   docVectorRepo,
 	}
 }
 
-// Process 是文件处理的主函数。
+// Process 是文件处理的主函数。它在每个阶段开始时更新 file_upload 的处理状态，
+// 失败时记录 failed 与错误信息，成功后置为 ready。
 func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask) error {
+	state := &model.ProcessingState{}
+	if err := p.process(ctx, task, state); err != nil {
+		state.Error = err.Error()
+		p.setStatus(task, state, model.ProcessingStatusFailed)
+		return err
+	}
+	p.setStatus(task, state, model.ProcessingStatusReady)
+	return nil
+}
+
+// setStatus 将处理进度写入共享该文件内容的全部 file_upload 记录。写入失败只记录日志，不影响处理流程。
+func (p *Processor) setStatus(task tasks.FileProcessingTask, state *model.ProcessingState, status string) {
+	state.Status = status
+	if err := p.uploadRepo.UpdateSharedProcessingState(task.FileMD5, *state); err != nil {
+		log.Warnf("[Processor] 更新处理状态为 %s 失败, FileMD5: %s, Error: %v", status, task.FileMD5, err)
+	}
+}
+
+func (p *Processor) process(ctx context.Context, task tasks.FileProcessingTask, state *model.ProcessingState) error {
 	log.Infof("[Processor] 开始处理文件, FileMD5: %s, FileName: %s, UserID: %d", task.FileMD5, task.FileName, task.UserID)
+	p.setStatus(task, state, model.ProcessingStatusExtracting)
 
 	// 1. 从 MinIO 下载文件
-	objectName := fmt.Sprintf("merged/%s", task.FileName)
+	// 旧版本产生的任务没有对象键，以文件记录中的为准（记录可能已被迁移到新的对象键）
+	objectName := task.ObjectKey
+	if objectName == "" {
+		record, err := p.uploadRepo.GetFileUploadRecord(task.FileMD5, task.UserID)
+		if err != nil {
+			return fmt.Errorf("查询文件记录失败: %w", err)
+		}
+		objectName = record.StorageKey()
+	}
 	log.Infof("[Processor] 步骤1: 从MinIO下载文件, Bucket: %s, Object: %s", p.minioCfg.BucketName, objectName)
 	object, err := storage.MinioClient.GetObject(ctx, p.minioCfg.BucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
@@ -104,8 +146,10 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 	log.Infof("[Processor] 步骤2: 文本提取成功, 内容长度: %d 字符", utf8.RuneCountInString(textContent))
 
 	// 3. 文本切块
-	log.Info("[Processor] 步骤3: 进行文本分块, chunkSize: 1000, chunkOverlap: 100")
-	chunks := p.splitText(textContent, 1000, 100)
+	p.setStatus(task, state, model.ProcessingStatusChunking)
+	chunkCfg := p.chunkingCfg.ForFile(task.FileName)
+	log.Infof("[Processor] 步骤3: 进行文本分块, strategy: %s, chunkSize: %d, chunkOverlap: %d", chunkCfg.Strategy, chunkCfg.ChunkSize, chunkCfg.ChunkOverlap)
+	chunks := NewChunker(chunkCfg).Split(textContent)
 	log.Infof("[Processor] 步骤3: 文本分块完成, 共生成 %d 个分块", len(chunks))
 	if len(chunks) == 0 {
 		log.Warnf("[Processor] 未生成任何文本分块, 处理中止, FileName: %s", task.FileName)
@@ -118,15 +162,18 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 	if err := p.docVectorRepo.DeleteByFileMD5(task.FileMD5); err != nil {
 		log.Warnf("[Processor] 清理 document_vectors 旧记录失败 (file_md5=%s): %v", task.FileMD5, err)
 	}
+	// 记录本次处理所用的 embedding 模型版本（重建索引任务完成后会切换模型）
+	modelVersion := p.embeddingClient.Model()
 	dbVectors := make([]*model.DocumentVector, 0, len(chunks))
 	for i, chunk := range chunks {
 		dbVectors = append(dbVectors, &model.DocumentVector{
-			FileMD5:     task.FileMD5,
-			ChunkID:     i,
-			TextContent: chunk,
-			UserID:      task.UserID,
-			OrgTag:      task.OrgTag,
-			IsPublic:    task.IsPublic,
+			FileMD5:      task.FileMD5,
+			ChunkID:      i,
+			TextContent:  chunk,
+			ModelVersion: modelVersion,
+			UserID:       task.UserID,
+			OrgTag:       task.OrgTag,
+			IsPublic:     task.IsPublic,
 		})
 	}
 	if err := p.docVectorRepo.BatchCreate(dbVectors); err != nil {
@@ -134,6 +181,7 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 		return fmt.Errorf("批量保存文本分块失败: %w", err)
 	}
 	log.Infof("[Processor] 阶段一: 成功将 %d 个分块存入数据库", len(dbVectors))
+	state.ChunkCount = len(dbVectors)
 
 	// 阶段二：从数据库读取，进行向量化，然后索引到ES
 	log.Info("[Processor] 阶段二: 开始从数据库读取分块并进行向量化")
@@ -144,83 +192,186 @@ func (p *Processor) Process(ctx context.Context, task tasks.FileProcessingTask)
 	}
 	log.Infof("[Processor] 阶段二: 成功从数据库读取 %d 个分块", len(savedVectors))
 
-	// 4. 向量化并索引到 ES
-	log.Info("[Processor] 步骤4: 开始遍历分块并进行向量化与索引")
-	for i, docVector := range savedVectors {
-		log.Infof("[Processor] 正在处理分块 %d/%d, ChunkID: %d", i+1, len(savedVectors), docVector.ChunkID)
-		// 4a. 向量化
-		vector, err := p.embeddingClient.CreateEmbedding(ctx, docVector.TextContent)
-		if err != nil {
-			log.Errorf("[Processor] 分块 %d 向量化失败, Error: %v", docVector.ChunkID, err)
-			return fmt.Errorf("块 %d 向量化失败: %w", docVector.ChunkID, err)
-		}
+	// 4. 批量并发向量化
+	p.setStatus(task, state, model.ProcessingStatusEmbedding)
+	log.Info("[Processor] 步骤4: 开始批量向量化")
+	vectors, err := p.embedChunks(ctx, savedVectors)
+	if err != nil {
+		log.Errorf("[Processor] 向量化失败, FileMD5: %s, Error: %v", task.FileMD5, err)
+		return fmt.Errorf("向量化失败: %w", err)
+	}
+	log.Infof("[Processor] 步骤4: 向量化完成, 共 %d 个分块", len(vectors))
 
-		// 4b. 准备 ES 的 EsDocument 对象
+	// 5. 通过 _bulk API 批量索引到 ES，结束后统一 refresh 一次
+	log.Info("[Processor] 步骤5: 开始将分块批量索引到 Elasticsearch")
+	p.setStatus(task, state, model.ProcessingStatusIndexing)
+	owners, err := p.loadOwners(task)
+	if err != nil {
+		if errors.Is(err, errNoOwners) {
+			p.discardChunks(ctx, task)
+		}
+		return err
+	}
+	indexer, err := es.NewBulkIndexer(p.esCfg.IndexName)
+	if err != nil {
+		return err
+	}
+	for i, docVector := range savedVectors {
 		esDoc := model.EsDocument{
 			VectorID:     fmt.Sprintf("%s_%d", docVector.FileMD5, docVector.ChunkID),
 			FileMD5:      docVector.FileMD5,
 			ChunkID:      docVector.ChunkID,
 			TextContent:  docVector.TextContent,
-			Vector:       vector,
-			ModelVersion: p.embeddingCfg.Model,
-			UserID:       docVector.UserID,
-			OrgTag:       docVector.OrgTag,
-			IsPublic:     docVector.IsPublic,
+			Vector:       vectors[i],
+			ModelVersion: modelVersion,
+			UserID:       owners.UserIDs,
+			OrgTag:       owners.OrgTags,
+			IsPublic:     owners.IsPublic,
+			FileType:     owners.FileType,
+			UploadedAt:   owners.UploadedAt,
 		}
-		log.Infof("[Processor] 准备索引到ES的文档 (ChunkID: %d)", esDoc.ChunkID)
-
-		// 4c. 索引到 Elasticsearch
-		if err := es.IndexDocument(ctx, p.esCfg.IndexName, esDoc); err != nil {
-			log.Errorf("[Processor] 索引分块 %d 到Elasticsearch失败, Error: %v", docVector.ChunkID, err)
-			return fmt.Errorf("索引块 %d 到 Elasticsearch 失败: %w", docVector.ChunkID, err)
+		if err := indexer.Add(ctx, esDoc); err != nil {
+			_, _ = indexer.Close(ctx)
+			log.Errorf("[Processor] 添加分块 %d 到批量索引队列失败, Error: %v", docVector.ChunkID, err)
+			return fmt.Errorf("添加块 %d 到批量索引队列失败: %w", docVector.ChunkID, err)
 		}
-		log.Infof("[Processor] 分块 %d/%d 向量化并索引成功", i+1, len(savedVectors))
 	}
-	log.Info("[Processor] 步骤4: 所有分块处理完毕")
+	bulkResult, err := indexer.Close(ctx)
+	if bulkResult != nil {
+		state.IndexedCount = int(bulkResult.Indexed)
+	}
+	if err != nil {
+		log.Errorf("[Processor] 批量索引到Elasticsearch失败, Error: %v", err)
+		return fmt.Errorf("批量索引到 Elasticsearch 失败: %w", err)
+	}
+	if len(bulkResult.Failures) > 0 {
+		for _, f := range bulkResult.Failures {
+			log.Errorf("[Processor] 分块索引失败, VectorID: %s, Status: %d, Reason: %s", f.VectorID, f.Status, f.Reason)
+		}
+		return fmt.Errorf("%d 个分块索引到 Elasticsearch 失败, 首个错误: %s", len(bulkResult.Failures), bulkResult.Failures[0].Reason)
+	}
+	log.Infof("[Processor] 步骤5: 批量索引成功, 共 %d 个分块", bulkResult.Indexed)
 
+	// 新分块已按 vector_id 覆盖旧分块；重新处理后分块变少时，清理编号超出新分块数的旧分块
+	stale, err := es.DeleteChunksFrom(ctx, p.esCfg.IndexName, task.FileMD5, len(savedVectors))
+	if err != nil {
+		return fmt.Errorf("清理 Elasticsearch 中的旧分块失败: %w", err)
+	}
+	if stale > 0 {
+		log.Infof("[Processor] 已清理 %d 个旧分块, FileMD5: %s", stale, task.FileMD5)
+	}
+
+	// 索引期间可能有其他用户秒传了同一文件，其所有者更新早于分块写入时会被覆盖，这里补齐
+	// 索引期间文件被删除时，删除流程可能早于分块写入，这里移除已写入的分块
+	latest, err := p.loadOwners(task)
+	if err != nil {
+		if errors.Is(err, errNoOwners) {
+			p.discardChunks(ctx, task)
+		}
+		return err
+	}
+	if !latest.Equal(owners) {
+		if _, err := es.UpdateOwners(ctx, p.esCfg.IndexName, task.FileMD5, latest); err != nil {
+			return fmt.Errorf("同步文件所有者到 Elasticsearch 失败: %w", err)
+		}
+	}
 	log.Infof("[Processor] 文件处理成功完成, FileMD5: %s", task.FileMD5)
 	return nil
 }
 
-// splitText 将长文本按指定大小和重叠进行切分。
-func (p *Processor) splitText(text string, chunkSize int, chunkOverlap int) []string {
-	if chunkSize <= chunkOverlap {
-		// Fallback to simple split if overlap is invalid
-		return p.simpleSplit(text, chunkSize)
+// loadOwners 读取共享该文件内容的全部所有者。没有已完成的记录时（如记录已被删除）返回 errNoOwners，
+// 不能退回任务中的所有者，否则已删除文件的分块会以原上传者的权限重新出现在检索结果中。
+func (p *Processor) loadOwners(task tasks.FileProcessingTask) (model.DocumentOwners, error) {
+	files, err := p.uploadRepo.FindBatchByMD5s([]string{task.FileMD5})
+	if err != nil {
+		return model.DocumentOwners{}, fmt.Errorf("查询文件所有者失败: %w", err)
+	}
+	owners, ok := model.GroupOwners(files)[task.FileMD5]
+	if !ok {
+		return model.DocumentOwners{}, errNoOwners
+	}
+	return owners, nil
+}
+
+// discardChunks 删除本次处理为已删除文件写入的分块与向量记录。失败只记录日志。
+func (p *Processor) discardChunks(ctx context.Context, task tasks.FileProcessingTask) {
+	log.Warnf("[Processor] 文件记录已删除, 清理本次写入的分块, FileMD5: %s", task.FileMD5)
+	if _, err := es.DeleteByFileMD5(ctx, p.esCfg.IndexName, task.FileMD5); err != nil {
+		log.Warnf("[Processor] 删除 Elasticsearch 分块失败, FileMD5: %s, Error: %v", task.FileMD5, err)
+	}
+	if err := p.docVectorRepo.DeleteByFileMD5(task.FileMD5); err != nil {
+		log.Warnf("[Processor] 删除 document_vectors 记录失败, FileMD5: %s, Error: %v", task.FileMD5, err)
 	}
+}
 
-	var chunks []string
-	runes := []rune(text)
-	if len(runes) == 0 {
-		return nil
+// embedChunks 使用 Processor 的 embedding 客户端与配置对分块进行向量化。
+func (p *Processor) embedChunks(ctx context.Context, docs []*model.DocumentVector) ([][]float32, error) {
+	return EmbedDocuments(ctx, p.embeddingClient, p.embeddingCfg, docs)
+}
+
+// EmbedDocuments 将分块按 batch_size 分批，以不超过 concurrency 的并发度调用 Embedding API。
+// 返回的向量与 docs 一一对应；任一批次失败时取消其余请求并返回该错误。
+func EmbedDocuments(ctx context.Context, client embedding.Client, cfg config.EmbeddingConfig, docs []*model.DocumentVector) ([][]float32, error) {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultEmbeddingBatchSize
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultEmbeddingConcurrency
 	}
 
-	step := chunkSize - chunkOverlap
-	for i := 0; i < len(runes); i += step {
-		end := i + chunkSize
-		if end > len(runes) {
-			end = len(runes)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	vectors := make([][]float32, len(docs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	totalBatches := (len(docs) + batchSize - 1) / batchSize
+	for start := 0; start < len(docs); start += batchSize {
+		end := start + batchSize
+		if end > len(docs) {
+			end = len(docs)
 		}
-		chunks = append(chunks, string(runes[i:end]))
-		if end == len(runes) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
 			break
 		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			texts := make([]string, 0, end-start)
+			for _, d := range docs[start:end] {
+				texts = append(texts, d.TextContent)
+			}
+			batch, err := client.CreateEmbeddings(ctx, texts)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("分块 %d-%d 向量化失败: %w", docs[start].ChunkID, docs[end-1].ChunkID, err)
+					cancel()
+				})
+				return
+			}
+			copy(vectors[start:end], batch)
+			log.Infof("[Embedding] 批次 %d/%d 向量化成功", start/batchSize+1, totalBatches)
+		}(start, end)
 	}
-	return chunks
-}
+	wg.Wait()
 
-func (p *Processor) simpleSplit(text string, chunkSize int) []string {
-	var chunks []string
-	runes := []rune(text)
-	if len(runes) == 0 {
-		return nil
+	if firstErr != nil {
+		return nil, firstErr
 	}
-	for i := 0; i < len(runes); i += chunkSize {
-		end := i + chunkSize
-		if end > len(runes) {
-			end = len(runes)
-		}
-		chunks = append(chunks, string(runes[i:end]))
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return chunks
+	return vectors, nil
 }
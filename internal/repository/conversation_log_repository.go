@@ -0,0 +1,88 @@
+// Package repository 定义了与数据库进行数据交换的接口和实现。
+package repository
+
+import (
+	"context"
+	"pai-smart-go/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConversationLogFilter 定义了查询对话记录的可选过滤条件。
+type ConversationLogFilter struct {
+	UserID    *uint
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// ConversationLogRepository 定义了对 conversations 表的数据操作接口。
+// 与 Redis 中的短期历史不同，这里保存每一轮问答的完整、永久记录。
+type ConversationLogRepository interface {
+	Create(ctx context.Context, record *model.Conversation) error
+	FindByConversationID(ctx context.Context, userID uint, conversationID string) ([]model.Conversation, error)
+	FindLatestByConversationID(ctx context.Context, conversationID string, limit int) ([]model.Conversation, error)
+	Find(ctx context.Context, filter ConversationLogFilter, offset, limit int) ([]model.Conversation, int64, error)
+}
+
+type conversationLogRepository struct {
+	db *gorm.DB
+}
+
+// NewConversationLogRepository 创建一个新的 ConversationLogRepository 实例。
+func NewConversationLogRepository(db *gorm.DB) ConversationLogRepository {
+	return &conversationLogRepository{db: db}
+}
+
+// Create 写入一轮问答记录。
+func (r *conversationLogRepository) Create(ctx context.Context, record *model.Conversation) error {
+	return r.db.WithContext(ctx).Create(record).Error
+}
+
+// FindByConversationID 按时间顺序返回用户某个会话的全部问答记录。
+func (r *conversationLogRepository) FindByConversationID(ctx context.Context, userID uint, conversationID string) ([]model.Conversation, error) {
+	var records []model.Conversation
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND conversation_id = ?", userID, conversationID).
+		Order("id ASC").
+		Find(&records).Error
+	return records, err
+}
+
+// FindLatestByConversationID 按时间顺序返回会话最近的 limit 轮问答，用于重建 Redis 中的历史。
+func (r *conversationLogRepository) FindLatestByConversationID(ctx context.Context, conversationID string, limit int) ([]model.Conversation, error) {
+	var records []model.Conversation
+	err := r.db.WithContext(ctx).
+		Where("conversation_id = ?", conversationID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+// Find 按过滤条件分页返回问答记录（按时间倒序）以及符合条件的总数。
+func (r *conversationLogRepository) Find(ctx context.Context, filter ConversationLogFilter, offset, limit int) ([]model.Conversation, int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.Conversation{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.StartTime != nil {
+		query = query.Where("created_at >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		query = query.Where("created_at <= ?", *filter.EndTime)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []model.Conversation
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&records).Error
+	return records, total, err
+}
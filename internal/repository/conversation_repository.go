@@ -4,52 +4,115 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"pai-smart-go/internal/model"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
 )
 
-// ConversationRepository 定义了对话历史记录的操作接口。
+const (
+	// conversationTTL 是 Redis 中 prompt 历史与当前会话指针的保留时间，每次更新都会续期。
+	conversationTTL = 7 * 24 * time.Hour
+	// DefaultConversationTitle 是新建会话的默认标题，首轮提问后会被替换为问题摘要。
+	DefaultConversationTitle = "新对话"
+	// MaxHistoryMessages 是 Redis 中为构建 prompt 保留的最近消息条数，完整记录见 ConversationLogRepository。
+	MaxHistoryMessages = 20
+	// maxConversationTitleRunes 是会话标题的最大长度（按字符计）。
+	maxConversationTitleRunes = 50
+)
+
+// ErrConversationNotFound 表示会话不存在或不属于当前用户。
+var ErrConversationNotFound = errors.New("会话不存在")
+
+// ConversationRepository 定义了对话会话与历史记录的操作接口。
+// 会话及其标题保存在 MySQL 中永久有效；Redis 只缓存构建 prompt 的最近历史与用户的当前会话，过期后可从 MySQL 恢复。
 type ConversationRepository interface {
 	GetOrCreateConversationID(ctx context.Context, userID uint) (string, error)
 	GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error)
 	UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error
 	GetAllUserConversationMappings(ctx context.Context) (map[uint]string, error)
+
+	// 多会话管理
+	CreateSession(ctx context.Context, userID uint, title string) (*model.ConversationSession, error)
+	GetSession(ctx context.Context, userID uint, conversationID string) (*model.ConversationSession, error)
+	ListSessions(ctx context.Context, userID uint) ([]model.ConversationSession, error)
+	UpdateSession(ctx context.Context, session *model.ConversationSession) error
+	DeleteSession(ctx context.Context, userID uint, conversationID string) error
+	SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error
 }
 
-type redisConversationRepository struct {
+type conversationRepository struct {
+	db          *gorm.DB
 	redisClient *redis.Client
 }
 
 // NewConversationRepository 创建一个新的 ConversationRepository 实例。
-func NewConversationRepository(redisClient *redis.Client) ConversationRepository {
-	return &redisConversationRepository{redisClient: redisClient}
+func NewConversationRepository(db *gorm.DB, redisClient *redis.Client) ConversationRepository {
+	return &conversationRepository{db: db, redisClient: redisClient}
 }
 
-// GetOrCreateConversationID 获取或创建一个新的对话ID。
-func (r *redisConversationRepository) GetOrCreateConversationID(ctx context.Context, userID uint) (string, error) {
-	userKey := fmt.Sprintf("user:%d:current_conversation", userID)
-	convID, err := r.redisClient.Get(ctx, userKey).Result()
-	if err == redis.Nil {
-		// generate uuid-like using timestamp+userID (avoid heavy deps)
-		convID = fmt.Sprintf("%d-%d", time.Now().UnixNano(), userID)
-		if err := r.redisClient.Set(ctx, userKey, convID, 7*24*time.Hour).Err(); err != nil {
-			return "", fmt.Errorf("failed to set conversation id: %w", err)
+// TruncateTitle 去除首尾空白并将会话标题截断到 maxConversationTitleRunes 个字符。
+func TruncateTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	runes := []rune(title)
+	if len(runes) > maxConversationTitleRunes {
+		return string(runes[:maxConversationTitleRunes]) + "…"
+	}
+	return title
+}
+
+func currentConversationKey(userID uint) string {
+	return fmt.Sprintf("user:%d:current_conversation", userID)
+}
+
+func historyKey(conversationID string) string {
+	return fmt.Sprintf("conversation:%s", conversationID)
+}
+
+// newConversationID generates a uuid-like id using timestamp+userID (avoid heavy deps)
+func newConversationID(userID uint) string {
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), userID)
+}
+
+// GetOrCreateConversationID 获取用户当前会话的 ID。Redis 中的当前会话指针过期或指向已删除的会话时，
+// 退回到最近更新的会话；用户没有任何会话时新建一个。
+func (r *conversationRepository) GetOrCreateConversationID(ctx context.Context, userID uint) (string, error) {
+	convID, err := r.redisClient.Get(ctx, currentConversationKey(userID)).Result()
+	if err != nil && err != redis.Nil {
+		return "", fmt.Errorf("failed to get conversation id: %w", err)
+	}
+	if err == nil {
+		if _, err := r.GetSession(ctx, userID, convID); err == nil {
+			return convID, nil
+		} else if !errors.Is(err, ErrConversationNotFound) {
+			return "", err
 		}
-		return convID, nil
 	}
+
+	latest, err := r.latestSession(ctx, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get conversation id: %w", err)
+		return "", err
+	}
+	if latest != nil {
+		if err := r.SetCurrentConversationID(ctx, userID, latest.ID); err != nil {
+			return "", err
+		}
+		return latest.ID, nil
 	}
-	return convID, nil
+	session, err := r.CreateSession(ctx, userID, DefaultConversationTitle)
+	if err != nil {
+		return "", err
+	}
+	return session.ID, nil
 }
 
 // GetConversationHistory 从 Redis 获取对话历史记录。
-func (r *redisConversationRepository) GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
-	key := fmt.Sprintf("conversation:%s", conversationID)
-	jsonData, err := r.redisClient.Get(ctx, key).Result()
+func (r *conversationRepository) GetConversationHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+	jsonData, err := r.redisClient.Get(ctx, historyKey(conversationID)).Result()
 	if err == redis.Nil {
 		return []model.ChatMessage{}, nil // No history yet
 	}
@@ -65,17 +128,16 @@ func (r *redisConversationRepository) GetConversationHistory(ctx context.Context
 }
 
 // UpdateConversationHistory 在 Redis 中更新对话历史记录。
-func (r *redisConversationRepository) UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
-	key := fmt.Sprintf("conversation:%s", conversationID)
-	// 保留最近 20 条
-	if len(messages) > 20 {
-		messages = messages[len(messages)-20:]
+func (r *conversationRepository) UpdateConversationHistory(ctx context.Context, conversationID string, messages []model.ChatMessage) error {
+	// 保留最近 MaxHistoryMessages 条
+	if len(messages) > MaxHistoryMessages {
+		messages = messages[len(messages)-MaxHistoryMessages:]
 	}
 	jsonData, err := json.Marshal(messages)
 	if err != nil {
 		return fmt.Errorf("failed to marshal conversation history: %w", err)
 	}
-	err = r.redisClient.Set(ctx, key, jsonData, 7*24*time.Hour).Err()
+	err = r.redisClient.Set(ctx, historyKey(conversationID), jsonData, conversationTTL).Err()
 	if err != nil {
 		return fmt.Errorf("failed to set conversation history: %w", err)
 	}
@@ -83,7 +145,7 @@ func (r *redisConversationRepository) UpdateConversationHistory(ctx context.Cont
 }
 
 // GetAllUserConversationMappings returns map[userID]conversationID by scanning user:*:current_conversation
-func (r *redisConversationRepository) GetAllUserConversationMappings(ctx context.Context) (map[uint]string, error) {
+func (r *conversationRepository) GetAllUserConversationMappings(ctx context.Context) (map[uint]string, error) {
 	keys, err := r.redisClient.Keys(ctx, "user:*:current_conversation").Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan user conversation keys: %w", err)
@@ -104,3 +166,122 @@ func (r *redisConversationRepository) GetAllUserConversationMappings(ctx context
 	}
 	return result, nil
 }
+
+// CreateSession 新建一个会话并将其设为用户的当前会话。
+func (r *conversationRepository) CreateSession(ctx context.Context, userID uint, title string) (*model.ConversationSession, error) {
+	if title == "" {
+		title = DefaultConversationTitle
+	}
+	now := time.Now()
+	session := &model.ConversationSession{
+		ID:        newConversationID(userID),
+		UserID:    userID,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.db.WithContext(ctx).Create(session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create conversation session: %w", err)
+	}
+	if err := r.SetCurrentConversationID(ctx, userID, session.ID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSession 获取用户的指定会话，会话不存在、已删除或属于其他用户时返回 ErrConversationNotFound。
+func (r *conversationRepository) GetSession(ctx context.Context, userID uint, conversationID string) (*model.ConversationSession, error) {
+	var session model.ConversationSession
+	err := r.db.WithContext(ctx).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation session: %w", err)
+	}
+	return &session, nil
+}
+
+// ListSessions 按最后更新时间倒序返回用户的全部会话。
+func (r *conversationRepository) ListSessions(ctx context.Context, userID uint) ([]model.ConversationSession, error) {
+	var sessions []model.ConversationSession
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("updated_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// UpdateSession 保存会话的标题与最后更新时间。
+func (r *conversationRepository) UpdateSession(ctx context.Context, session *model.ConversationSession) error {
+	err := r.db.WithContext(ctx).Model(&model.ConversationSession{}).
+		Where("conversation_id = ? AND user_id = ?", session.ID, session.UserID).
+		Updates(map[string]interface{}{"title": session.Title, "updated_at": session.UpdatedAt}).Error
+	if err != nil {
+		return fmt.Errorf("failed to save conversation session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession 删除会话及其 Redis 中的历史。若删除的是当前会话，则切换到最近更新的其他会话。
+// MySQL 中的永久问答记录不受影响。
+func (r *conversationRepository) DeleteSession(ctx context.Context, userID uint, conversationID string) error {
+	if _, err := r.GetSession(ctx, userID, conversationID); err != nil {
+		return err
+	}
+	err := r.db.WithContext(ctx).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Delete(&model.ConversationSession{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation session: %w", err)
+	}
+	if err := r.redisClient.Del(ctx, historyKey(conversationID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete conversation history: %w", err)
+	}
+
+	current, err := r.redisClient.Get(ctx, currentConversationKey(userID)).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get conversation id: %w", err)
+	}
+	if current != conversationID {
+		return nil
+	}
+	latest, err := r.latestSession(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if latest == nil {
+		return r.redisClient.Del(ctx, currentConversationKey(userID)).Err()
+	}
+	return r.SetCurrentConversationID(ctx, userID, latest.ID)
+}
+
+// SetCurrentConversationID 设置用户的当前会话，未指定会话的提问将写入该会话。
+func (r *conversationRepository) SetCurrentConversationID(ctx context.Context, userID uint, conversationID string) error {
+	if err := r.redisClient.Set(ctx, currentConversationKey(userID), conversationID, conversationTTL).Err(); err != nil {
+		return fmt.Errorf("failed to set conversation id: %w", err)
+	}
+	return nil
+}
+
+// latestSession 返回用户最近更新的会话，没有会话时返回 nil。
+func (r *conversationRepository) latestSession(ctx context.Context, userID uint) (*model.ConversationSession, error) {
+	var sessions []model.ConversationSession
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("updated_at DESC").
+		Limit(1).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest conversation session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return &sessions[0], nil
+}
@@ -0,0 +1,103 @@
+// Package repository 定义了与数据库进行数据交换的接口和实现。
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pai-smart-go/internal/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// deadLetterKey 是保存死信任务的 Redis Hash，字段为死信 ID。
+	deadLetterKey = "kafka:dead-letters"
+	// deadLetterIndexKey 是按失败时间排序的死信 ID 有序集合。
+	deadLetterIndexKey = "kafka:dead-letters:index"
+)
+
+// ErrDeadLetterNotFound 表示死信任务不存在。
+var ErrDeadLetterNotFound = errors.New("死信任务不存在")
+
+// DeadLetterRepository 定义了死信任务的存储操作。
+type DeadLetterRepository interface {
+	Save(ctx context.Context, deadLetter *model.DeadLetter) error
+	Get(ctx context.Context, id string) (*model.DeadLetter, error)
+	// List 按失败时间倒序返回死信任务，以及死信任务总数。
+	List(ctx context.Context, offset, limit int) ([]*model.DeadLetter, int64, error)
+}
+
+type redisDeadLetterRepository struct {
+	redisClient *redis.Client
+}
+
+// NewDeadLetterRepository 创建一个新的 DeadLetterRepository 实例。
+func NewDeadLetterRepository(redisClient *redis.Client) DeadLetterRepository {
+	return &redisDeadLetterRepository{redisClient: redisClient}
+}
+
+// Save 写入或覆盖一条死信任务。
+func (r *redisDeadLetterRepository) Save(ctx context.Context, deadLetter *model.DeadLetter) error {
+	data, err := json.Marshal(deadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+	pipe := r.redisClient.TxPipeline()
+	pipe.HSet(ctx, deadLetterKey, deadLetter.ID, data)
+	pipe.ZAdd(ctx, deadLetterIndexKey, &redis.Z{Score: float64(deadLetter.FailedAt.UnixMilli()), Member: deadLetter.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save dead letter: %w", err)
+	}
+	return nil
+}
+
+// Get 获取指定死信任务，不存在时返回 ErrDeadLetterNotFound。
+func (r *redisDeadLetterRepository) Get(ctx context.Context, id string) (*model.DeadLetter, error) {
+	data, err := r.redisClient.HGet(ctx, deadLetterKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+	var deadLetter model.DeadLetter
+	if err := json.Unmarshal(data, &deadLetter); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+	return &deadLetter, nil
+}
+
+// List 按失败时间倒序分页返回死信任务。
+func (r *redisDeadLetterRepository) List(ctx context.Context, offset, limit int) ([]*model.DeadLetter, int64, error) {
+	total, err := r.redisClient.ZCard(ctx, deadLetterIndexKey).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+	ids, err := r.redisClient.ZRevRange(ctx, deadLetterIndexKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*model.DeadLetter{}, total, nil
+	}
+
+	values, err := r.redisClient.HMGet(ctx, deadLetterKey, ids...).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+	deadLetters := make([]*model.DeadLetter, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var deadLetter model.DeadLetter
+		if err := json.Unmarshal([]byte(s), &deadLetter); err != nil {
+			continue
+		}
+		deadLetters = append(deadLetters, &deadLetter)
+	}
+	return deadLetters, total, nil
+}
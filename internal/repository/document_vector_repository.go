@@ -10,6 +10,17 @@ type DocumentVectorRepository interface {
 	BatchCreate(vectors []*model.DocumentVector) error
 	FindByFileMD5(fileMD5 string) ([]*model.DocumentVector, error)
 	DeleteByFileMD5(fileMD5 string) error
+	Count() (int64, error)
+	FindAfterID(afterID uint, limit int) ([]*model.DocumentVector, error)
+	UpdateModelVersionThrough(maxID uint, modelVersion string) error
+	CountByFileMD5s(md5s []string, maxID uint) (map[string]int64, error)
+	CountFilesAfter(afterMD5 string, maxID uint, limit int) ([]FileChunkCount, error)
+}
+
+// FileChunkCount 是一个文件在 document_vectors 中的分块记录数。
+type FileChunkCount struct {
+	FileMD5 string
+	Count   int64
 }
 
 type documentVectorRepository struct {
@@ -40,3 +51,57 @@ func (r *documentVectorRepository) FindByFileMD5(fileMD5 string) ([]*model.Docum
 func (r *documentVectorRepository) DeleteByFileMD5(fileMD5 string) error {
 	return r.db.Where("file_md5 = ?", fileMD5).Delete(&model.DocumentVector{}).Error
 }
+
+// Count 返回 document_vectors 表的总记录数。
+func (r *documentVectorRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&model.DocumentVector{}).Count(&count).Error
+	return count, err
+}
+
+// FindAfterID 按 vector_id 升序返回 ID 大于 afterID 的至多 limit 条记录，用于全表分页遍历。
+func (r *documentVectorRepository) FindAfterID(afterID uint, limit int) ([]*model.DocumentVector, error) {
+	var vectors []*model.DocumentVector
+	err := r.db.Where("vector_id > ?", afterID).Order("vector_id ASC").Limit(limit).Find(&vectors).Error
+	return vectors, err
+}
+
+// UpdateModelVersionThrough 将 vector_id 不超过 maxID 的记录标记为指定的向量模型版本。
+func (r *documentVectorRepository) UpdateModelVersionThrough(maxID uint, modelVersion string) error {
+	return r.db.Model(&model.DocumentVector{}).Where("vector_id <= ?", maxID).Update("model_version", modelVersion).Error
+}
+
+// CountByFileMD5s 统计每个文件 vector_id 不超过 maxID 的分块记录数，键为 file_md5，没有记录的文件不出现在结果中。
+func (r *documentVectorRepository) CountByFileMD5s(md5s []string, maxID uint) (map[string]int64, error) {
+	counts := make(map[string]int64, len(md5s))
+	if len(md5s) == 0 {
+		return counts, nil
+	}
+	var rows []FileChunkCount
+	err := r.db.Model(&model.DocumentVector{}).
+		Select("file_md5, COUNT(*) AS count").
+		Where("file_md5 IN ? AND vector_id <= ?", md5s, maxID).
+		Group("file_md5").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.FileMD5] = row.Count
+	}
+	return counts, nil
+}
+
+// CountFilesAfter 按 file_md5 升序返回 file_md5 大于 afterMD5 的至多 limit 个文件及其 vector_id 不超过 maxID 的分块记录数，
+// 用于按文件分页遍历全表。
+func (r *documentVectorRepository) CountFilesAfter(afterMD5 string, maxID uint, limit int) ([]FileChunkCount, error) {
+	var rows []FileChunkCount
+	err := r.db.Model(&model.DocumentVector{}).
+		Select("file_md5, COUNT(*) AS count").
+		Where("file_md5 > ? AND vector_id <= ?", afterMD5, maxID).
+		Group("file_md5").
+		Order("file_md5 ASC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,145 @@
+// Package repository 定义了与数据库进行数据交换的接口和实现。
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pai-smart-go/internal/model"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// reindexLockKey 保证同一时间只有一个重建索引任务在运行，值为持有锁的任务 ID。
+	reindexLockKey = "reindex:lock"
+	// reindexLatestKey 记录最近一次重建索引任务的 ID。
+	reindexLatestKey = "reindex:latest"
+	// reindexJobTTL 是任务记录在 Redis 中的保留时间。
+	reindexJobTTL = 30 * 24 * time.Hour
+)
+
+// ErrReindexJobNotFound 表示重建索引任务不存在。
+var ErrReindexJobNotFound = errors.New("重建索引任务不存在")
+
+// ReindexRepository 定义了重建索引任务的状态存储与互斥锁操作。
+type ReindexRepository interface {
+	SaveJob(ctx context.Context, job *model.ReindexJob) error
+	GetJob(ctx context.Context, jobID string) (*model.ReindexJob, error)
+	GetLatestJob(ctx context.Context) (*model.ReindexJob, error)
+
+	// AcquireLock 尝试获取任务锁，已被其他任务持有时返回 false。
+	AcquireLock(ctx context.Context, jobID string, ttl time.Duration) (bool, error)
+	// RefreshLock 为仍在运行的任务续期锁，防止长任务的锁过期。
+	RefreshLock(ctx context.Context, jobID string, ttl time.Duration) error
+	ReleaseLock(ctx context.Context, jobID string) error
+	// IsLockHeld 报告任务锁当前是否由 jobID 持有。
+	IsLockHeld(ctx context.Context, jobID string) (bool, error)
+}
+
+type redisReindexRepository struct {
+	redisClient *redis.Client
+}
+
+// NewReindexRepository 创建一个新的 ReindexRepository 实例。
+func NewReindexRepository(redisClient *redis.Client) ReindexRepository {
+	return &redisReindexRepository{redisClient: redisClient}
+}
+
+func reindexJobKey(jobID string) string {
+	return fmt.Sprintf("reindex:job:%s", jobID)
+}
+
+// SaveJob 保存任务的最新状态，并将其记为最近一次任务。
+func (r *redisReindexRepository) SaveJob(ctx context.Context, job *model.ReindexJob) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reindex job: %w", err)
+	}
+	pipe := r.redisClient.TxPipeline()
+	pipe.Set(ctx, reindexJobKey(job.JobID), data, reindexJobTTL)
+	pipe.Set(ctx, reindexLatestKey, job.JobID, reindexJobTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save reindex job: %w", err)
+	}
+	return nil
+}
+
+// GetJob 获取指定任务，不存在时返回 ErrReindexJobNotFound。
+func (r *redisReindexRepository) GetJob(ctx context.Context, jobID string) (*model.ReindexJob, error) {
+	data, err := r.redisClient.Get(ctx, reindexJobKey(jobID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrReindexJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reindex job: %w", err)
+	}
+	var job model.ReindexJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reindex job: %w", err)
+	}
+	return &job, nil
+}
+
+// GetLatestJob 获取最近一次任务，从未运行过时返回 ErrReindexJobNotFound。
+func (r *redisReindexRepository) GetLatestJob(ctx context.Context) (*model.ReindexJob, error) {
+	jobID, err := r.redisClient.Get(ctx, reindexLatestKey).Result()
+	if err == redis.Nil {
+		return nil, ErrReindexJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest reindex job id: %w", err)
+	}
+	return r.GetJob(ctx, jobID)
+}
+
+// AcquireLock 使用 SETNX 获取任务锁。
+func (r *redisReindexRepository) AcquireLock(ctx context.Context, jobID string, ttl time.Duration) (bool, error) {
+	ok, err := r.redisClient.SetNX(ctx, reindexLockKey, jobID, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire reindex lock: %w", err)
+	}
+	return ok, nil
+}
+
+// RefreshLock 在锁仍由 jobID 持有时延长其过期时间。
+func (r *redisReindexRepository) RefreshLock(ctx context.Context, jobID string, ttl time.Duration) error {
+	holder, err := r.redisClient.Get(ctx, reindexLockKey).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get reindex lock: %w", err)
+	}
+	if holder != jobID {
+		return fmt.Errorf("reindex lock is no longer held by job %s", jobID)
+	}
+	return r.redisClient.Expire(ctx, reindexLockKey, ttl).Err()
+}
+
+// ReleaseLock 在锁仍由 jobID 持有时释放它。
+func (r *redisReindexRepository) ReleaseLock(ctx context.Context, jobID string) error {
+	holder, err := r.redisClient.Get(ctx, reindexLockKey).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get reindex lock: %w", err)
+	}
+	if holder != jobID {
+		return nil
+	}
+	return r.redisClient.Del(ctx, reindexLockKey).Err()
+}
+
+// IsLockHeld 报告任务锁当前是否由 jobID 持有，锁已过期或被释放时返回 false。
+func (r *redisReindexRepository) IsLockHeld(ctx context.Context, jobID string) (bool, error) {
+	holder, err := r.redisClient.Get(ctx, reindexLockKey).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get reindex lock: %w", err)
+	}
+	return holder == jobID, nil
+}
@@ -3,37 +3,74 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 	"pai-smart-go/internal/model"
 	"strconv"
+	"time"
 )
 
+// FileUploadFilter 定义了查询已合并文件的可选过滤条件，多个条件同时生效。
+type FileUploadFilter struct {
+	FileMD5          string
+	UserID           *uint
+	OrgTag           string
+	ProcessingStatus string
+	// MissingObjectKey 只选择尚未迁移到按用户与 MD5 命名的对象键的旧记录
+	MissingObjectKey bool
+}
+
 // UploadRepository 接口定义了文件上传相关的数据持久化操作。
 type UploadRepository interface {
 	// FileUpload operations
 	CreateFileUploadRecord(record *model.FileUpload) error
 	GetFileUploadRecord(fileMD5 string, userID uint) (*model.FileUpload, error)
 	UpdateFileUploadStatus(recordID uint, status int) error
+	MarkMerged(recordID uint, objectKey string) error
+	UpdateObjectKey(recordID uint, objectKey string) error
+	TouchChunkUpload(recordID uint) error
+	UpdateProcessingState(fileMD5 string, userID uint, state model.ProcessingState) error
+	UpdateSharedProcessingState(fileMD5 string, state model.ProcessingState) error
 	FindFilesByUserID(userID uint) ([]model.FileUpload, error)
 	FindAccessibleFiles(userID uint, orgTags []string) ([]model.FileUpload, error)
+	FindMergedFiles(filter FileUploadFilter) ([]model.FileUpload, error)
+	FindShareableFiles(fileMD5 string, excludeUserID uint) ([]model.FileUpload, error)
+	FindStaleUploads(before time.Time, limit int) ([]model.FileUpload, error)
+	CountInProgressUploads(fileMD5 string) (int64, error)
+	DeleteStaleUpload(recordID uint, before time.Time) (bool, error)
+	CountObjectReferences(objectKey string) (int64, error)
 	DeleteFileUploadRecord(fileMD5 string, userID uint) error
+	DeleteFileContentRecords(fileMD5 string) error
 	UpdateFileUploadRecord(record *model.FileUpload) error
 	FindBatchByMD5s(md5s []string) ([]*model.FileUpload, error)
 
 	// ChunkInfo operations (GORM)
 	CreateChunkInfoRecord(record *model.ChunkInfo) error
 	GetChunkInfoRecords(fileMD5 string) ([]model.ChunkInfo, error)
+	DeleteChunkInfoRecords(fileMD5 string) error
 
 	// Chunk status operations (Redis)
 	IsChunkUploaded(ctx context.Context, fileMD5 string, userID uint, chunkIndex int) (bool, error)
 	MarkChunkUploaded(ctx context.Context, fileMD5 string, userID uint, chunkIndex int) error
 	GetUploadedChunksFromRedis(ctx context.Context, fileMD5 string, userID uint, totalChunks int) ([]int, error)
 	DeleteUploadMark(ctx context.Context, fileMD5 string, userID uint) error
+
+	// Possession challenge operations (Redis)
+	SavePossessionChallenge(ctx context.Context, fileMD5 string, userID uint, challenge *model.PossessionChallenge) error
+	TakePossessionChallenge(ctx context.Context, fileMD5 string, userID uint) (*model.PossessionChallenge, error)
+
+	// Pending document deletion operations (Redis)
+	SavePendingDeletion(ctx context.Context, deletion *model.DocumentDeletion) error
+	ListPendingDeletions(ctx context.Context) ([]*model.DocumentDeletion, error)
+	RemovePendingDeletion(ctx context.Context, fileMD5 string, userID uint) error
 }
 
+// pendingDeletionKey 是保存未完成文档删除记录的 Redis Hash。
+const pendingDeletionKey = "document:deletion:pending"
+
 // uploadRepository 是 UploadRepository 接口的 GORM+Redis 实现。
 type uploadRepository struct {
 	db          *gorm.DB
@@ -80,6 +117,61 @@ func (r *uploadRepository) UpdateFileUploadStatus(recordID uint, status int) err
 	return r.db.Model(&model.FileUpload{}).Where("id = ?", recordID).Update("status", status).Error
 }
 
+// MarkMerged 将记录标记为已合并，并保存合并文件的对象键。
+func (r *uploadRepository) MarkMerged(recordID uint, objectKey string) error {
+	return r.db.Model(&model.FileUpload{}).Where("id = ?", recordID).Updates(map[string]interface{}{
+		"status":     1,
+		"object_key": objectKey,
+		"merged_at":  time.Now(),
+	}).Error
+}
+
+// UpdateObjectKey 更新记录的对象键，用于迁移旧对象。
+func (r *uploadRepository) UpdateObjectKey(recordID uint, objectKey string) error {
+	return r.db.Model(&model.FileUpload{}).Where("id = ?", recordID).Updates(map[string]interface{}{
+		"object_key": objectKey,
+		"merged_at":  gorm.Expr("merged_at"),
+	}).Error
+}
+
+// TouchChunkUpload 记录最后一次上传分片的时间。
+func (r *uploadRepository) TouchChunkUpload(recordID uint) error {
+	return r.db.Model(&model.FileUpload{}).Where("id = ?", recordID).Updates(map[string]interface{}{
+		"last_chunk_at": time.Now(),
+		"merged_at":     gorm.Expr("merged_at"),
+	}).Error
+}
+
+// UpdateProcessingState 更新文件的处理状态、分块计数与错误信息。
+func (r *uploadRepository) UpdateProcessingState(fileMD5 string, userID uint, state model.ProcessingState) error {
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 = ? AND user_id = ?", fileMD5, userID).
+		Updates(map[string]interface{}{
+			"processing_status":     state.Status,
+			"chunk_count":           state.ChunkCount,
+			"indexed_count":         state.IndexedCount,
+			"processing_error":      state.Error,
+			"processing_updated_at": time.Now(),
+			// merged_at 带有 ON UPDATE CURRENT_TIMESTAMP，显式赋原值以免被处理进度刷新
+			"merged_at": gorm.Expr("merged_at"),
+		}).Error
+}
+
+// UpdateSharedProcessingState 更新共享同一文件内容的全部已完成记录的处理进度。
+// 分块与向量按 file_md5 共享，处理进度对所有所有者都相同。
+func (r *uploadRepository) UpdateSharedProcessingState(fileMD5 string, state model.ProcessingState) error {
+	return r.db.Model(&model.FileUpload{}).
+		Where("file_md5 = ? AND status = ?", fileMD5, 1).
+		Updates(map[string]interface{}{
+			"processing_status":     state.Status,
+			"chunk_count":           state.ChunkCount,
+			"indexed_count":         state.IndexedCount,
+			"processing_error":      state.Error,
+			"processing_updated_at": time.Now(),
+			"merged_at":             gorm.Expr("merged_at"),
+		}).Error
+}
+
 // GetChunkInfoRecords 获取指定文件已上传的所有分块信息 (from DB, used for merge)。
 func (r *uploadRepository) GetChunkInfoRecords(fileMD5 string) ([]model.ChunkInfo, error) {
 	var chunks []model.ChunkInfo
@@ -87,6 +179,11 @@ func (r *uploadRepository) GetChunkInfoRecords(fileMD5 string) ([]model.ChunkInf
 	return chunks, err
 }
 
+// DeleteChunkInfoRecords 删除指定文件的所有分块记录。
+func (r *uploadRepository) DeleteChunkInfoRecords(fileMD5 string) error {
+	return r.db.Where("file_md5 = ?", fileMD5).Delete(&model.ChunkInfo{}).Error
+}
+
 // FindFilesByUserID 查找指定用户上传的所有文件。
 func (r *uploadRepository) FindFilesByUserID(userID uint) ([]model.FileUpload, error) {
 	var files []model.FileUpload
@@ -107,8 +204,81 @@ func (r *uploadRepository) FindAccessibleFiles(userID uint, orgTags []string) ([
 	return files, err
 }
 
-// DeleteFileUploadRecord 删除一个文件上传记录, 包括 chunk 与 vector 的记录。
+// FindMergedFiles 查找已完成合并、符合过滤条件的文件。
+func (r *uploadRepository) FindMergedFiles(filter FileUploadFilter) ([]model.FileUpload, error) {
+	query := r.db.Where("status = ?", 1)
+	if filter.FileMD5 != "" {
+		query = query.Where("file_md5 = ?", filter.FileMD5)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.OrgTag != "" {
+		query = query.Where("org_tag = ?", filter.OrgTag)
+	}
+	if filter.ProcessingStatus != "" {
+		query = query.Where("processing_status = ?", filter.ProcessingStatus)
+	}
+	if filter.MissingObjectKey {
+		query = query.Where("object_key = ''")
+	}
+	var files []model.FileUpload
+	err := query.Order("id ASC").Find(&files).Error
+	return files, err
+}
+
+// FindShareableFiles 查找其他用户已完成上传、可供秒传复用的同内容文件，按上传顺序排列。
+// 只考虑已迁移到新对象键的记录，旧路径按文件名保存，迁移后会被删除。
+func (r *uploadRepository) FindShareableFiles(fileMD5 string, excludeUserID uint) ([]model.FileUpload, error) {
+	var files []model.FileUpload
+	err := r.db.Where("file_md5 = ? AND status = ? AND user_id <> ? AND object_key <> ''", fileMD5, 1, excludeUserID).
+		Order("id ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// staleUploadCondition 匹配最后一次活动早于指定时间的未完成上传。
+const staleUploadCondition = "status = 0 AND COALESCE(last_chunk_at, created_at) < ?"
+
+// FindStaleUploads 查找最后一次活动早于 before 的未完成上传，按活动时间从早到晚排列；limit <= 0 时不限制数量。
+func (r *uploadRepository) FindStaleUploads(before time.Time, limit int) ([]model.FileUpload, error) {
+	query := r.db.Where(staleUploadCondition, before).Order("COALESCE(last_chunk_at, created_at) ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var files []model.FileUpload
+	err := query.Find(&files).Error
+	return files, err
+}
+
+// CountInProgressUploads 统计指定文件尚未完成的上传数，分片对象与分片记录按 file_md5 共享。
+func (r *uploadRepository) CountInProgressUploads(fileMD5 string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.FileUpload{}).Where("file_md5 = ? AND status = ?", fileMD5, 0).Count(&count).Error
+	return count, err
+}
+
+// DeleteStaleUpload 在记录仍为过期的未完成上传时删除它，返回是否删除。
+// 条件在删除时重新判断，避免清理期间恢复上传或完成合并的记录被误删。
+func (r *uploadRepository) DeleteStaleUpload(recordID uint, before time.Time) (bool, error) {
+	result := r.db.Where("id = ?", recordID).Where(staleUploadCondition, before).Delete(&model.FileUpload{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountObjectReferences 统计引用指定对象键的文件记录数。
+func (r *uploadRepository) CountObjectReferences(objectKey string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.FileUpload{}).Where("object_key = ?", objectKey).Count(&count).Error
+	return count, err
+}
+
+// DeleteFileUploadRecord 删除用户的文件上传记录。分块与向量由同内容的所有记录共享，见 DeleteFileContentRecords。
 func (r *uploadRepository) DeleteFileUploadRecord(fileMD5 string, userID uint) error {
+	return r.db.Where("file_md5 = ? AND user_id = ?", fileMD5, userID).Delete(&model.FileUpload{}).Error
+}
+
+// DeleteFileContentRecords 删除文件内容的 chunk 与 vector 记录，应在最后一个所有者删除后调用。
+func (r *uploadRepository) DeleteFileContentRecords(fileMD5 string) error {
 	var errs []error
 
 	if err := r.db.Where("file_md5 = ?", fileMD5).Delete(&model.ChunkInfo{}).Error; err != nil {
@@ -117,11 +287,8 @@ func (r *uploadRepository) DeleteFileUploadRecord(fileMD5 string, userID uint) e
 	if err := r.db.Where("file_md5 = ?", fileMD5).Delete(&model.DocumentVector{}).Error; err != nil {
 		errs = append(errs, err)
 	}
-	if err := r.db.Where("file_md5 = ? AND user_id = ?", fileMD5, userID).Delete(&model.FileUpload{}).Error; err != nil {
-		errs = append(errs, err)
-	}
 	if len(errs) > 0 {
-		return fmt.Errorf("删除文件记录部分失败（fileMD5=%s, userID=%d）: %v", fileMD5, userID, errors.Join(errs...))
+		return fmt.Errorf("删除文件内容记录部分失败（fileMD5=%s）: %v", fileMD5, errors.Join(errs...))
 	}
 	return nil
 }
@@ -184,3 +351,69 @@ func (r *uploadRepository) DeleteUploadMark(ctx context.Context, fileMD5 string,
 	key := r.getRedisUploadKey(fileMD5, userID)
 	return r.redisClient.Del(ctx, key).Err()
 }
+
+// possessionChallengeKey 生成持有证明挑战的 Redis 键。
+func possessionChallengeKey(fileMD5 string, userID uint) string {
+	return "upload:challenge:" + strconv.FormatUint(uint64(userID), 10) + ":" + fileMD5
+}
+
+// SavePossessionChallenge 保存持有证明挑战，覆盖同一用户与文件之前的挑战，到期自动失效。
+func (r *uploadRepository) SavePossessionChallenge(ctx context.Context, fileMD5 string, userID uint, challenge *model.PossessionChallenge) error {
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return fmt.Errorf("failed to marshal possession challenge: %w", err)
+	}
+	return r.redisClient.Set(ctx, possessionChallengeKey(fileMD5, userID), data, time.Until(challenge.ExpiresAt)).Err()
+}
+
+// TakePossessionChallenge 取出并删除持有证明挑战，保证每个挑战只能使用一次；不存在或已过期时返回 nil。
+func (r *uploadRepository) TakePossessionChallenge(ctx context.Context, fileMD5 string, userID uint) (*model.PossessionChallenge, error) {
+	data, err := r.redisClient.GetDel(ctx, possessionChallengeKey(fileMD5, userID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var challenge model.PossessionChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal possession challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// pendingDeletionField 生成删除记录在 Hash 中的字段名。
+func pendingDeletionField(fileMD5 string, userID uint) string {
+	return strconv.FormatUint(uint64(userID), 10) + ":" + fileMD5
+}
+
+// SavePendingDeletion 写入或覆盖一条未完成的删除记录。
+func (r *uploadRepository) SavePendingDeletion(ctx context.Context, deletion *model.DocumentDeletion) error {
+	data, err := json.Marshal(deletion)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending deletion: %w", err)
+	}
+	return r.redisClient.HSet(ctx, pendingDeletionKey, pendingDeletionField(deletion.FileMD5, deletion.UserID), data).Err()
+}
+
+// ListPendingDeletions 返回所有未完成的删除记录。
+func (r *uploadRepository) ListPendingDeletions(ctx context.Context) ([]*model.DocumentDeletion, error) {
+	values, err := r.redisClient.HGetAll(ctx, pendingDeletionKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending deletions: %w", err)
+	}
+	deletions := make([]*model.DocumentDeletion, 0, len(values))
+	for _, v := range values {
+		var d model.DocumentDeletion
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			continue
+		}
+		deletions = append(deletions, &d)
+	}
+	return deletions, nil
+}
+
+// RemovePendingDeletion 删除一条已完成的删除记录。
+func (r *uploadRepository) RemovePendingDeletion(ctx context.Context, fileMD5 string, userID uint) error {
+	return r.redisClient.HDel(ctx, pendingDeletionKey, pendingDeletionField(fileMD5, userID)).Err()
+}
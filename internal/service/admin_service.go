@@ -22,6 +22,16 @@ type UserListResponse struct {
 	Number        int                  `json:"number"`
 }
 
+// ConversationListResponse 定义了管理员对话记录 API 的响应结构，分页字段与用户列表一致。
+// 分页以一轮问答为单位，每轮展开为提问与回答两条消息。
+type ConversationListResponse struct {
+	Content       []map[string]interface{} `json:"content"`
+	TotalElements int64                    `json:"totalElements"`
+	TotalPages    int                      `json:"totalPages"`
+	Size          int                      `json:"size"`
+	Number        int                      `json:"number"`
+}
+
 // UserDetailResponse 定义了用户列表项的详细结构。
 type UserDetailResponse struct {
 	UserID     uint            `json:"userId"`
@@ -51,22 +61,22 @@ type AdminService interface {
 	// User Management
 	AssignOrgTagsToUser(userID uint, orgTags []string) error
 	ListUsers(page, size int) (*UserListResponse, error)
-	GetAllConversations(ctx context.Context, userID *uint, startTime, endTime *time.Time) ([]map[string]interface{}, error)
+	GetAllConversations(ctx context.Context, userID *uint, startTime, endTime *time.Time, page, size int) (*ConversationListResponse, error)
 }
 
 // adminService 是 AdminService 接口的实现。
 type adminService struct {
-	orgTagRepo       repository.OrgTagRepository
-	userRepo         repository.UserRepository
-	conversationRepo repository.ConversationRepository
+	orgTagRepo          repository.OrgTagRepository
+	userRepo            repository.UserRepository
+	conversationLogRepo repository.ConversationLogRepository
 }
 
 // NewAdminService 创建一个新的 AdminService 实例。
-func NewAdminService(orgTagRepo repository.OrgTagRepository, userRepo repository.UserRepository, conversationRepo repository.ConversationRepository) AdminService {
+func NewAdminService(orgTagRepo repository.OrgTagRepository, userRepo repository.UserRepository, conversationLogRepo repository.ConversationLogRepository) AdminService {
 	return &adminService{
-		orgTagRepo:       orgTagRepo,
-		userRepo:         userRepo,
-		conversationRepo: conversationRepo,
+		orgTagRepo:          orgTagRepo,
+		userRepo:            userRepo,
+		conversationLogRepo: conversationLogRepo,
 	}
 }
 
@@ -231,65 +241,62 @@ func (s *adminService) ListUsers(page, size int) (*UserListResponse, error) {
 }
 
 // GetAllConversations retrieves conversation histories for all or a specific user, with optional date filtering.
-func (s *adminService) GetAllConversations(ctx context.Context, userID *uint, startTime, endTime *time.Time) ([]map[string]interface{}, error) {
-	var allConversations []map[string]interface{}
-	if userID != nil {
-		user, err := s.userRepo.FindByID(*userID)
-		if err != nil {
-			return nil, errors.New("user not found")
-		}
-		return s.getConversationsForUser(ctx, user, startTime, endTime)
-	}
-
-	mappings, err := s.conversationRepo.GetAllUserConversationMappings(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user conversation mappings from redis: %w", err)
+// 数据来自 MySQL 中的永久对话记录，按时间倒序分页，每轮问答展开为提问与回答两条消息。
+func (s *adminService) GetAllConversations(ctx context.Context, userID *uint, startTime, endTime *time.Time, page, size int) (*ConversationListResponse, error) {
+	if page < 1 {
+		page = 1
 	}
-
-	for uid := range mappings {
-		user, err := s.userRepo.FindByID(uid)
-		if err != nil {
-			continue
-		}
-		userConversations, err := s.getConversationsForUser(ctx, user, startTime, endTime)
-		if err != nil {
-			continue
-		}
-		allConversations = append(allConversations, userConversations...)
+	if size < 1 {
+		size = 10
 	}
-	return allConversations, nil
-}
-
-func (s *adminService) getConversationsForUser(ctx context.Context, user *model.User, startTime, endTime *time.Time) ([]map[string]interface{}, error) {
-	conversationID, err := s.conversationRepo.GetOrCreateConversationID(ctx, user.ID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "redis: nil" {
-			return []map[string]interface{}{}, nil
+	if userID != nil {
+		if _, err := s.userRepo.FindByID(*userID); err != nil {
+			return nil, errors.New("user not found")
 		}
-		return nil, fmt.Errorf("failed to get conversation id: %w", err)
 	}
 
-	history, err := s.conversationRepo.GetConversationHistory(ctx, conversationID)
+	filter := repository.ConversationLogFilter{UserID: userID, StartTime: startTime, EndTime: endTime}
+	turns, total, err := s.conversationLogRepo.Find(ctx, filter, (page-1)*size, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conversation history: %w", err)
+		return nil, fmt.Errorf("failed to get conversation logs: %w", err)
 	}
 
-	var userConversations []map[string]interface{}
-	for _, msg := range history {
-		// Time filtering
-		if startTime != nil && msg.Timestamp.Before(*startTime) {
-			continue
-		}
-		if endTime != nil && msg.Timestamp.After(*endTime) {
-			continue
+	usernames := make(map[uint]string)
+	allConversations := make([]map[string]interface{}, 0, len(turns)*2)
+	for _, turn := range turns {
+		username, ok := usernames[turn.UserID]
+		if !ok {
+			user, err := s.userRepo.FindByID(turn.UserID)
+			if err != nil {
+				continue
+			}
+			username = user.Username
+			usernames[turn.UserID] = username
 		}
-
-		userConversations = append(userConversations, map[string]interface{}{
-			"username":  user.Username,
-			"role":      msg.Role,
-			"content":   msg.Content,
-			"timestamp": msg.Timestamp.Format("2006-01-02T15:04:05"),
-		})
+		timestamp := turn.CreatedAt.Format("2006-01-02T15:04:05")
+		allConversations = append(allConversations,
+			map[string]interface{}{
+				"username":       username,
+				"conversationId": turn.ConversationID,
+				"role":           "user",
+				"content":        turn.Question,
+				"timestamp":      timestamp,
+			},
+			map[string]interface{}{
+				"username":       username,
+				"conversationId": turn.ConversationID,
+				"role":           "assistant",
+				"content":        turn.Answer,
+				"sources":        turn.Sources,
+				"timestamp":      timestamp,
+			},
+		)
 	}
-	return userConversations, nil
+	return &ConversationListResponse{
+		Content:       allConversations,
+		TotalElements: total,
+		TotalPages:    (int(total) + size - 1) / size,
+		Size:          size,
+		Number:        page,
+	}, nil
 }
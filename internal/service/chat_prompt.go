@@ -0,0 +1,122 @@
+// Package service 包含了应用的业务逻辑层。
+package service
+
+import (
+	"fmt"
+	"pai-smart-go/internal/config"
+	"pai-smart-go/internal/model"
+	"pai-smart-go/pkg/log"
+	"pai-smart-go/pkg/tokenizer"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultContextWindow 是未配置 llm.context_window 时假定的模型上下文窗口（token）。
+	defaultContextWindow = 32768
+	// defaultReservedOutputTokens 是未配置 max_tokens 时为模型输出预留的 token 数。
+	defaultReservedOutputTokens = 2048
+	// messageOverheadTokens 是每条消息的角色标记等格式开销的估算值。
+	messageOverheadTokens = 4
+	// maxSnippetTokens 是单个检索片段进入 prompt 的 token 上限，与切块大小同量级，尽量不截断分块内容。
+	maxSnippetTokens = 1000
+)
+
+// assemblePrompt 在上下文窗口预算内组装发送给模型的消息，并返回实际进入 prompt 的检索结果。
+// 预算为上下文窗口减去输出预留；超出时先从最早的历史消息开始丢弃，再丢弃得分最低的检索片段。
+// 返回的检索结果保持原有顺序，其编号与 prompt 中的 [n] 一致。
+func (s *chatService) assemblePrompt(query string, results []model.SearchResponseDTO, history []model.ChatMessage, reservedOutputTokens int) ([]model.ChatMessage, []model.SearchResponseDTO) {
+	contextWindow := config.Conf.LLM.ContextWindow
+	if contextWindow <= 0 {
+		contextWindow = defaultContextWindow
+	}
+	budget := contextWindow - reservedOutputTokens
+
+	// system 消息中规则与包裹符的固定部分，以及本轮提问
+	used := tokenizer.Count(s.buildSystemMessage("")) + tokenizer.Count(query) + 2*messageOverheadTokens
+
+	historyCosts := make([]int, len(history))
+	historyTotal := 0
+	for i, m := range history {
+		historyCosts[i] = tokenizer.Count(m.Content) + messageOverheadTokens
+		historyTotal += historyCosts[i]
+	}
+	snippetCosts := make([]int, len(results))
+	snippetTotal := 0
+	for i, r := range results {
+		snippetCosts[i] = tokenizer.Count(formatSnippet(i+1, r))
+		snippetTotal += snippetCosts[i]
+	}
+
+	// 1. 从最早的消息开始丢弃历史，并保证剩余历史以用户消息开头
+	start := 0
+	for start < len(history) && used+historyTotal+snippetTotal > budget {
+		historyTotal -= historyCosts[start]
+		start++
+		for start < len(history) && history[start].Role != "user" {
+			historyTotal -= historyCosts[start]
+			start++
+		}
+	}
+	if start > 0 {
+		log.Infof("[ChatService] prompt 超出预算，丢弃最早的 %d 条历史消息", start)
+	}
+	history = history[start:]
+
+	// 2. 按得分从低到高丢弃检索片段
+	dropped := make([]bool, len(results))
+	if used+historyTotal+snippetTotal > budget {
+		order := make([]int, len(results))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return results[order[a]].Score < results[order[b]].Score })
+		for _, i := range order {
+			if used+historyTotal+snippetTotal <= budget {
+				break
+			}
+			dropped[i] = true
+			snippetTotal -= snippetCosts[i]
+		}
+	}
+	kept := make([]model.SearchResponseDTO, 0, len(results))
+	for i, r := range results {
+		if !dropped[i] {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) < len(results) {
+		log.Infof("[ChatService] prompt 超出预算，丢弃 %d 个低分检索片段", len(results)-len(kept))
+	}
+	if used+historyTotal+snippetTotal > budget {
+		log.Warnf("[ChatService] 仅 system 指令与提问已超出上下文预算: used=%d, budget=%d", used, budget)
+	}
+
+	systemMsg := s.buildSystemMessage(s.buildContextText(kept))
+	return s.composeMessages(systemMsg, history, query), kept
+}
+
+// buildContextText 根据搜索结果构建 system 消息中的参考信息，按顺序编号为 [1]、[2]……
+func (s *chatService) buildContextText(searchResults []model.SearchResponseDTO) string {
+	if len(searchResults) == 0 {
+		return ""
+	}
+	var contextBuilder strings.Builder
+	for i, r := range searchResults {
+		contextBuilder.WriteString(formatSnippet(i+1, r))
+	}
+	return contextBuilder.String()
+}
+
+// formatSnippet 将单个检索结果格式化为带编号的一行参考信息，内容按 token 截断且不会切断多字节字符。
+func formatSnippet(index int, r model.SearchResponseDTO) string {
+	snippet := r.TextContent
+	if truncated := tokenizer.Truncate(snippet, maxSnippetTokens); len(truncated) < len(snippet) {
+		snippet = truncated + "…"
+	}
+	fileLabel := r.FileName
+	if fileLabel == "" {
+		fileLabel = "unknown"
+	}
+	return fmt.Sprintf("[%d] (%s) %s\n", index, fileLabel, snippet)
+}
@@ -18,48 +18,60 @@ import (
 
 // ChatService 定义了聊天操作的接口。
 type ChatService interface {
-	StreamResponse(ctx context.Context, query string, user *model.User, ws *websocket.Conn, shouldStop func() bool) error
+	StreamResponse(ctx context.Context, conversationID, query string, user *model.User, ws *websocket.Conn, shouldStop func() bool) error
 }
 
 type chatService struct {
-	searchService    SearchService
-	llmClient        llm.Client
-	conversationRepo repository.ConversationRepository
+	searchService       SearchService
+	llmClient           llm.Client
+	conversationRepo    repository.ConversationRepository
+	conversationLogRepo repository.ConversationLogRepository
 }
 
 // NewChatService 创建一个新的 ChatService 实例。
-func NewChatService(searchService SearchService, llmClient llm.Client, conversationRepo repository.ConversationRepository) ChatService {
+func NewChatService(searchService SearchService, llmClient llm.Client, conversationRepo repository.ConversationRepository, conversationLogRepo repository.ConversationLogRepository) ChatService {
 	return &chatService{
-		searchService:    searchService,
-		llmClient:        llmClient,
-		conversationRepo: conversationRepo,
+		searchService:       searchService,
+		llmClient:           llmClient,
+		conversationRepo:    conversationRepo,
+		conversationLogRepo: conversationLogRepo,
 	}
 }
 
 // StreamResponse 协调 RAG 流程并流式传输 LLM 响应。
-func (s *chatService) StreamResponse(ctx context.Context, query string, user *model.User, ws *websocket.Conn, shouldStop func() bool) error {
+// conversationID 为空时使用用户的当前会话，否则在指定会话中继续对话并将其设为当前会话。
+func (s *chatService) StreamResponse(ctx context.Context, conversationID, query string, user *model.User, ws *websocket.Conn, shouldStop func() bool) error {
+	session, err := s.resolveSession(ctx, user.ID, conversationID)
+	if err != nil {
+		return err
+	}
+
 	// 1. 使用 SearchService 检索上下文（提升覆盖度：topK=10）
-	results, err := s.searchService.HybridSearch(ctx, query, 10, user)
+	result, err := s.searchService.HybridSearch(ctx, query, 10, user, SearchOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to retrieve context: %w", err)
 	}
 
-	// 2. 构建上下文与 system 消息、历史
-	contextText := s.buildContextText(results)
-	systemMsg := s.buildSystemMessage(contextText)
-	history, err := s.loadHistory(ctx, user.ID)
+	// 2. 在 token 预算内组装 system 消息、历史与检索片段，并先行下发实际引用的来源
+	history, err := s.loadHistory(ctx, session.ID)
 	if err != nil {
 		log.Errorf("Failed to load conversation history: %v", err)
 		history = []model.ChatMessage{}
 	}
-	messages := s.composeMessages(systemMsg, history, query)
+	gen := s.buildGenerationParams()
+	reservedOutput := defaultReservedOutputTokens
+	if gen != nil && gen.MaxTokens != nil {
+		reservedOutput = *gen.MaxTokens
+	}
+	messages, results := s.assemblePrompt(query, result.Results, history, reservedOutput)
+	sources := buildSources(results)
+	sendSources(ws, session.ID, sources)
 
 	// 拦截 websocket writer 以捕获完整答案，并包装为 JSON 分块
 	answerBuilder := &strings.Builder{}
 	interceptor := &wsWriterInterceptor{conn: ws, writer: answerBuilder, shouldStop: shouldStop}
 
 	// 3. 调用 LLM 客户端以流式传输响应（带生成参数）
-	gen := s.buildGenerationParams()
 	var llmMsgs []llm.Message
 	for _, m := range messages {
 		llmMsgs = append(llmMsgs, llm.Message{Role: m.Role, Content: m.Content})
@@ -69,43 +81,24 @@ func (s *chatService) StreamResponse(ctx context.Context, query string, user *mo
 		return err
 	}
 
-	// 4. 发送完成通知，并将对话保存到 Redis
-	sendCompletion(ws)
+	// 4. 发送完成通知，并将对话保存到 Redis（prompt 历史）与 MySQL（永久记录）
+	sendCompletion(ws, session.ID)
 	fullAnswer := answerBuilder.String()
 	if len(fullAnswer) > 0 {
 		// 使用后台上下文，因为即使原始请求被取消，我们也希望保存成功生成的答案
-		err = s.addMessageToConversation(context.Background(), user.ID, query, fullAnswer)
+		// 两处写入互不影响，只记录错误，不返回给客户端，因为流式响应已经成功
+		err = s.addMessageToConversation(context.Background(), session, query, fullAnswer, sources)
 		if err != nil {
-			// 只记录错误，不返回给客户端，因为流式响应已经成功
 			log.Errorf("Failed to save conversation history: %v", err)
 		}
+		if err := s.archiveTurn(context.Background(), session, query, fullAnswer, sources); err != nil {
+			log.Errorf("Failed to archive conversation turn: %v", err)
+		}
 	}
 
 	return nil
 }
 
-// buildPrompt 根据用户输入和搜索结果构建prompt
-func (s *chatService) buildContextText(searchResults []model.SearchResponseDTO) string {
-	if len(searchResults) == 0 {
-		return ""
-	}
-	// 与 Processor 的 chunkSize 对齐，尽量不截断分块内容
-	const maxSnippetLen = 1000
-	var contextBuilder strings.Builder
-	for i, r := range searchResults {
-		snippet := r.TextContent
-		if len(snippet) > maxSnippetLen {
-			snippet = snippet[:maxSnippetLen] + "…"
-		}
-		fileLabel := r.FileName
-		if fileLabel == "" {
-			fileLabel = "unknown"
-		}
-		contextBuilder.WriteString(fmt.Sprintf("[%d] (%s) %s\n", i+1, fileLabel, snippet))
-	}
-	return contextBuilder.String()
-}
-
 func (s *chatService) buildSystemMessage(contextText string) string {
 	// 从配置读取规则与包裹符
 	// 优先使用 Java 风格 ai.prompt；若缺失则回退 llm.prompt
@@ -151,12 +144,37 @@ func (s *chatService) buildSystemMessage(contextText string) string {
 	return sys.String()
 }
 
-func (s *chatService) loadHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error) {
-	convID, err := s.conversationRepo.GetOrCreateConversationID(ctx, userID)
+// resolveSession 确定本轮问答所属的会话：未指定时取当前会话，指定时校验归属并切换为当前会话。
+func (s *chatService) resolveSession(ctx context.Context, userID uint, conversationID string) (*model.ConversationSession, error) {
+	if conversationID == "" {
+		var err error
+		conversationID, err = s.conversationRepo.GetOrCreateConversationID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get or create conversation ID: %w", err)
+		}
+		return s.conversationRepo.GetSession(ctx, userID, conversationID)
+	}
+	session, err := s.conversationRepo.GetSession(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.conversationRepo.SetCurrentConversationID(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// loadHistory 从 Redis 读取 prompt 历史；Redis 中的历史过期后，从 MySQL 的永久记录中重建最近几轮。
+func (s *chatService) loadHistory(ctx context.Context, conversationID string) ([]model.ChatMessage, error) {
+	history, err := s.conversationRepo.GetConversationHistory(ctx, conversationID)
+	if err != nil || len(history) > 0 {
+		return history, err
+	}
+	turns, err := s.conversationLogRepo.FindLatestByConversationID(ctx, conversationID, repository.MaxHistoryMessages/2)
 	if err != nil {
 		return nil, err
 	}
-	return s.conversationRepo.GetConversationHistory(ctx, convID)
+	return turnsToMessages(turns), nil
 }
 
 func (s *chatService) composeMessages(systemMsg string, history []model.ChatMessage, userInput string) []model.ChatMessage {
@@ -167,14 +185,41 @@ func (s *chatService) composeMessages(systemMsg string, history []model.ChatMess
 	return msgs
 }
 
-// addMessageToConversation 是一个用于管理 Redis 中对话历史的辅助函数。
-func (s *chatService) addMessageToConversation(ctx context.Context, userID uint, question, answer string) error {
-	conversationID, err := s.conversationRepo.GetOrCreateConversationID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get or create conversation ID: %w", err)
+// buildSources 将进入 prompt 的检索结果转换为引用来源，编号与 buildContextText 中的 [n] 一一对应。
+func buildSources(searchResults []model.SearchResponseDTO) []model.ConversationSource {
+	const maxSourceSnippetRunes = 200
+	sources := make([]model.ConversationSource, 0, len(searchResults))
+	for i, r := range searchResults {
+		snippet := []rune(r.TextContent)
+		if len(snippet) > maxSourceSnippetRunes {
+			snippet = append(snippet[:maxSourceSnippetRunes], '…')
+		}
+		sources = append(sources, model.ConversationSource{
+			Index:    i + 1,
+			FileMD5:  r.FileMD5,
+			FileName: r.FileName,
+			ChunkID:  r.ChunkID,
+			Score:    r.Score,
+			Snippet:  string(snippet),
+		})
 	}
+	return sources
+}
 
-	history, err := s.conversationRepo.GetConversationHistory(ctx, conversationID)
+// archiveTurn 将本轮问答及其引用来源写入 MySQL。
+func (s *chatService) archiveTurn(ctx context.Context, session *model.ConversationSession, question, answer string, sources []model.ConversationSource) error {
+	return s.conversationLogRepo.Create(ctx, &model.Conversation{
+		UserID:         session.UserID,
+		ConversationID: session.ID,
+		Question:       question,
+		Answer:         answer,
+		Sources:        sources,
+	})
+}
+
+// addMessageToConversation 是一个用于管理 Redis 中对话历史的辅助函数，同时刷新会话的更新时间与标题。
+func (s *chatService) addMessageToConversation(ctx context.Context, session *model.ConversationSession, question, answer string, sources []model.ConversationSource) error {
+	history, err := s.loadHistory(ctx, session.ID)
 	if err != nil {
 		return fmt.Errorf("failed to get conversation history: %w", err)
 	}
@@ -190,10 +235,22 @@ func (s *chatService) addMessageToConversation(ctx context.Context, userID uint,
 	history = append(history, model.ChatMessage{
 		Role:      "assistant",
 		Content:   answer,
+		Sources:   sources,
 		Timestamp: time.Now(),
 	})
 
-	return s.conversationRepo.UpdateConversationHistory(ctx, conversationID, history)
+	if err := s.conversationRepo.UpdateConversationHistory(ctx, session.ID, history); err != nil {
+		return err
+	}
+
+	// 首轮提问时用问题摘要替换默认标题
+	if session.Title == repository.DefaultConversationTitle {
+		if title := repository.TruncateTitle(question); title != "" {
+			session.Title = title
+		}
+	}
+	session.UpdatedAt = time.Now()
+	return s.conversationRepo.UpdateSession(ctx, session)
 }
 
 // wsWriterInterceptor 是对 websocket.Conn 的封装，用于捕获写入的消息。
@@ -216,14 +273,27 @@ func (w *wsWriterInterceptor) WriteMessage(messageType int, data []byte) error {
 	return w.conn.WriteMessage(messageType, b)
 }
 
-// sendCompletion 发送完成通知 JSON
-func sendCompletion(ws *websocket.Conn) {
+// sendSources 在回答分块之前发送本轮的引用来源 JSON
+func sendSources(ws *websocket.Conn, conversationID string, sources []model.ConversationSource) {
+	notif := map[string]interface{}{
+		"type":           "sources",
+		"conversationId": conversationID,
+		"sources":        sources,
+		"timestamp":      time.Now().UnixMilli(),
+	}
+	b, _ := json.Marshal(notif)
+	_ = ws.WriteMessage(websocket.TextMessage, b)
+}
+
+// sendCompletion 发送完成通知 JSON，附带本轮所属的会话 ID
+func sendCompletion(ws *websocket.Conn, conversationID string) {
 	notif := map[string]interface{}{
-		"type":      "completion",
-		"status":    "finished",
-		"message":   "响应已完成",
-		"timestamp": time.Now().UnixMilli(),
-		"date":      time.Now().Format("2006-01-02T15:04:05"),
+		"type":           "completion",
+		"status":         "finished",
+		"message":        "响应已完成",
+		"conversationId": conversationID,
+		"timestamp":      time.Now().UnixMilli(),
+		"date":           time.Now().Format("2006-01-02T15:04:05"),
 	}
 	b, _ := json.Marshal(notif)
 	_ = ws.WriteMessage(websocket.TextMessage, b)
@@ -3,31 +3,53 @@ package service
 
 import (
 	"context"
+	"errors"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/internal/repository"
+	"time"
 )
 
 // ConversationService 定义了对话业务逻辑的接口。
 type ConversationService interface {
-	GetConversationHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error)
+	GetConversationHistory(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error)
 	AddMessageToConversation(ctx context.Context, userID uint, message model.ChatMessage) error
+
+	CreateConversation(ctx context.Context, userID uint, title string) (*model.ConversationSession, error)
+	ListConversations(ctx context.Context, userID uint) ([]model.ConversationSession, error)
+	SwitchConversation(ctx context.Context, userID uint, conversationID string) (*model.ConversationSession, error)
+	RenameConversation(ctx context.Context, userID uint, conversationID, title string) (*model.ConversationSession, error)
+	DeleteConversation(ctx context.Context, userID uint, conversationID string) error
 }
 
 type conversationService struct {
-	repo repository.ConversationRepository
+	repo    repository.ConversationRepository
+	logRepo repository.ConversationLogRepository
 }
 
 // NewConversationService 创建一个新的 ConversationService。
-func NewConversationService(repo repository.ConversationRepository) ConversationService {
-	return &conversationService{repo: repo}
+func NewConversationService(repo repository.ConversationRepository, logRepo repository.ConversationLogRepository) ConversationService {
+	return &conversationService{repo: repo, logRepo: logRepo}
 }
 
-// GetConversationHistory 获取用户当前会话的完整消息历史。
-func (s *conversationService) GetConversationHistory(ctx context.Context, userID uint) ([]model.ChatMessage, error) {
-	conversationID, err := s.repo.GetOrCreateConversationID(ctx, userID)
+// GetConversationHistory 获取指定会话的完整消息历史，conversationID 为空时使用用户的当前会话。
+// 完整历史来自 MySQL；没有永久记录的旧会话回退到 Redis 中的最近历史。
+func (s *conversationService) GetConversationHistory(ctx context.Context, userID uint, conversationID string) ([]model.ChatMessage, error) {
+	if conversationID == "" {
+		var err error
+		conversationID, err = s.repo.GetOrCreateConversationID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := s.repo.GetSession(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	turns, err := s.logRepo.FindByConversationID(ctx, userID, conversationID)
 	if err != nil {
 		return nil, err
 	}
+	if len(turns) > 0 {
+		return turnsToMessages(turns), nil
+	}
 	return s.repo.GetConversationHistory(ctx, conversationID)
 }
 
@@ -44,3 +66,60 @@ func (s *conversationService) AddMessageToConversation(ctx context.Context, user
 	history = append(history, message)
 	return s.repo.UpdateConversationHistory(ctx, conversationID, history)
 }
+
+// CreateConversation 新建一个会话并切换到该会话。
+func (s *conversationService) CreateConversation(ctx context.Context, userID uint, title string) (*model.ConversationSession, error) {
+	return s.repo.CreateSession(ctx, userID, repository.TruncateTitle(title))
+}
+
+// ListConversations 按最后更新时间倒序列出用户的全部会话。
+func (s *conversationService) ListConversations(ctx context.Context, userID uint) ([]model.ConversationSession, error) {
+	return s.repo.ListSessions(ctx, userID)
+}
+
+// SwitchConversation 将指定会话设为用户的当前会话。
+func (s *conversationService) SwitchConversation(ctx context.Context, userID uint, conversationID string) (*model.ConversationSession, error) {
+	session, err := s.repo.GetSession(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCurrentConversationID(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RenameConversation 修改会话标题。
+func (s *conversationService) RenameConversation(ctx context.Context, userID uint, conversationID, title string) (*model.ConversationSession, error) {
+	title = repository.TruncateTitle(title)
+	if title == "" {
+		return nil, errors.New("会话标题不能为空")
+	}
+	session, err := s.repo.GetSession(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	session.Title = title
+	session.UpdatedAt = time.Now()
+	if err := s.repo.UpdateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// DeleteConversation 删除会话及其消息历史。MySQL 中的永久问答记录不受影响。
+func (s *conversationService) DeleteConversation(ctx context.Context, userID uint, conversationID string) error {
+	return s.repo.DeleteSession(ctx, userID, conversationID)
+}
+
+// turnsToMessages 将 MySQL 中的问答记录展开为按时间排列的消息列表。
+func turnsToMessages(turns []model.Conversation) []model.ChatMessage {
+	messages := make([]model.ChatMessage, 0, len(turns)*2)
+	for _, t := range turns {
+		messages = append(messages,
+			model.ChatMessage{Role: "user", Content: t.Question, Timestamp: t.CreatedAt},
+			model.ChatMessage{Role: "assistant", Content: t.Answer, Sources: t.Sources, Timestamp: t.CreatedAt},
+		)
+	}
+	return messages
+}
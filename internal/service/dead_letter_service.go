@@ -0,0 +1,114 @@
+// Package service 包含了应用的业务逻辑层。
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pai-smart-go/internal/model"
+	"pai-smart-go/internal/repository"
+	"pai-smart-go/pkg/kafka"
+	"pai-smart-go/pkg/log"
+	"pai-smart-go/pkg/tasks"
+	"time"
+)
+
+// DeadLetterListResponse 定义了死信任务列表 API 的响应结构，分页字段与用户列表一致。
+type DeadLetterListResponse struct {
+	Content       []*model.DeadLetter `json:"content"`
+	TotalElements int64               `json:"totalElements"`
+	TotalPages    int                 `json:"totalPages"`
+	Size          int                 `json:"size"`
+	Number        int                 `json:"number"`
+}
+
+// DeadLetterService 定义了死信任务的记录、查看与重放操作。
+// 它同时实现 kafka.DeadLetterRecorder，由 Kafka 消费者在任务重试耗尽时调用。
+type DeadLetterService interface {
+	RecordDeadLetter(ctx context.Context, task tasks.DeadLetterTask) error
+	ListDeadLetters(ctx context.Context, page, size int) (*DeadLetterListResponse, error)
+	GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error)
+}
+
+type deadLetterService struct {
+	deadLetterRepo repository.DeadLetterRepository
+	uploadRepo     repository.UploadRepository
+}
+
+// NewDeadLetterService 创建一个新的 DeadLetterService 实例。
+func NewDeadLetterService(deadLetterRepo repository.DeadLetterRepository, uploadRepo repository.UploadRepository) DeadLetterService {
+	return &deadLetterService{deadLetterRepo: deadLetterRepo, uploadRepo: uploadRepo}
+}
+
+// RecordDeadLetter 保存一条死信任务。同一 ID 重复记录时保留已有的重放信息。
+func (s *deadLetterService) RecordDeadLetter(ctx context.Context, task tasks.DeadLetterTask) error {
+	deadLetter := &model.DeadLetter{
+		ID:       task.ID,
+		Task:     task.Task,
+		Error:    task.Error,
+		Attempts: task.Attempts,
+		FailedAt: task.FailedAt,
+	}
+	existing, err := s.deadLetterRepo.Get(ctx, task.ID)
+	if err != nil && !errors.Is(err, repository.ErrDeadLetterNotFound) {
+		return err
+	}
+	if existing != nil {
+		deadLetter.ReplayCount = existing.ReplayCount
+		deadLetter.ReplayedAt = existing.ReplayedAt
+	}
+	return s.deadLetterRepo.Save(ctx, deadLetter)
+}
+
+// ListDeadLetters 按失败时间倒序分页返回死信任务。
+func (s *deadLetterService) ListDeadLetters(ctx context.Context, page, size int) (*DeadLetterListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 10
+	}
+	deadLetters, total, err := s.deadLetterRepo.List(ctx, (page-1)*size, size)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterListResponse{
+		Content:       deadLetters,
+		TotalElements: total,
+		TotalPages:    (int(total) + size - 1) / size,
+		Size:          size,
+		Number:        page,
+	}, nil
+}
+
+// GetDeadLetter 返回指定死信任务的详情，包括原始任务与最后一次错误。
+func (s *deadLetterService) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	return s.deadLetterRepo.Get(ctx, id)
+}
+
+// ReplayDeadLetter 将死信任务重新发送到主主题，按新任务重新计算重试次数。
+// 死信记录会保留并标记重放次数，重放后仍失败会产生一条新的死信记录。
+func (s *deadLetterService) ReplayDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	deadLetter, err := s.deadLetterRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	queued := model.ProcessingState{Status: model.ProcessingStatusQueued}
+	if err := s.uploadRepo.UpdateSharedProcessingState(deadLetter.Task.FileMD5, queued); err != nil {
+		log.Warnf("[DeadLetter] 更新文件处理状态为排队中失败, fileMD5: %s, error: %v", deadLetter.Task.FileMD5, err)
+	}
+	if err := kafka.ProduceFileTask(deadLetter.Task); err != nil {
+		return nil, fmt.Errorf("重新发送文件处理任务失败: %w", err)
+	}
+
+	now := time.Now()
+	deadLetter.ReplayCount++
+	deadLetter.ReplayedAt = &now
+	if err := s.deadLetterRepo.Save(ctx, deadLetter); err != nil {
+		log.Warnf("[DeadLetter] 保存重放记录失败, id: %s, error: %v", id, err)
+	}
+	log.Infof("[DeadLetter] 死信任务已重放, id: %s, fileMD5: %s", id, deadLetter.Task.FileMD5)
+	return deadLetter, nil
+}
@@ -9,7 +9,11 @@ import (
 	"pai-smart-go/internal/config"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/internal/repository"
+	"pai-smart-go/pkg/es"
+	"pai-smart-go/pkg/kafka"
+	"pai-smart-go/pkg/log"
 	"pai-smart-go/pkg/storage"
+	"pai-smart-go/pkg/tasks"
 	"strings"
 	"time"
 
@@ -17,6 +21,9 @@ import (
 	"pai-smart-go/pkg/tika"
 )
 
+// maxDeletionAttempts 是对账任务重试一条删除记录的最大次数，超过后放弃并记录错误日志。
+const maxDeletionAttempts = 10
+
 // FileUploadDTO 是一个数据传输对象，用于在返回给前端时隐藏一些字段并添加额外信息。
 type FileUploadDTO struct {
 	model.FileUpload
@@ -37,13 +44,54 @@ type PreviewInfoDTO struct {
 	FileSize int64  `json:"fileSize"`
 }
 
+// ProcessingStatusDTO 描述文件合并后在处理流水线中的进度。
+type ProcessingStatusDTO struct {
+	FileMD5      string     `json:"fileMd5"`
+	FileName     string     `json:"fileName"`
+	Status       string     `json:"status"`
+	ChunkCount   int        `json:"chunkCount"`
+	IndexedCount int        `json:"indexedCount"`
+	Error        string     `json:"error"`
+	UpdatedAt    *time.Time `json:"updatedAt"`
+}
+
+// ReprocessRequest 描述要重新处理的文件范围，多个条件同时生效，至少需要指定一个。
+// Failed 为 true 时只选择处理失败的文件。
+type ReprocessRequest struct {
+	FileMD5 string `json:"fileMd5"`
+	UserID  *uint  `json:"userId"`
+	OrgTag  string `json:"orgTag"`
+	Failed  bool   `json:"failed"`
+}
+
+// ReprocessFailure 记录一个未能重新入队的文件。
+type ReprocessFailure struct {
+	FileMD5 string `json:"fileMd5"`
+	UserID  uint   `json:"userId"`
+	Error   string `json:"error"`
+}
+
+// ReprocessResult 汇总一次重新处理请求的入队结果。Matched 与 Queued 按文件内容（file_md5）计数。
+type ReprocessResult struct {
+	Matched  int                `json:"matched"`
+	Queued   int                `json:"queued"`
+	Failures []ReprocessFailure `json:"failures"`
+}
+
+// ErrEmptyReprocessScope 表示重新处理请求未指定任何范围。
+var ErrEmptyReprocessScope = errors.New("请至少指定 fileMd5、userId、orgTag 或 failed 中的一个条件")
+
 // DocumentService 接口定义了文档管理相关的业务操作。
 type DocumentService interface {
 	ListAccessibleFiles(user *model.User) ([]model.FileUpload, error)
 	ListUploadedFiles(userID uint) ([]FileUploadDTO, error)
+	GetProcessingStatus(fileMD5 string, userID uint) (*ProcessingStatusDTO, error)
 	DeleteDocument(fileMD5 string, user *model.User) error
-	GenerateDownloadURL(fileName string, user *model.User) (*DownloadInfoDTO, error)
-	GetFilePreviewContent(fileName string, user *model.User) (*PreviewInfoDTO, error)
+	GenerateDownloadURL(fileName, fileMD5 string, user *model.User) (*DownloadInfoDTO, error)
+	GetFilePreviewContent(fileName, fileMD5 string, user *model.User) (*PreviewInfoDTO, error)
+	ReconcilePendingDeletions(ctx context.Context) (int, error)
+	ReprocessDocuments(ctx context.Context, req ReprocessRequest) (*ReprocessResult, error)
+	MigrateObjectKeys(ctx context.Context) (int, error)
 }
 
 type documentService struct {
@@ -51,16 +99,18 @@ type documentService struct {
 	userRepo   repository.UserRepository
 	orgTagRepo repository.OrgTagRepository // 新增依赖
 	minioCfg   config.MinIOConfig
+	esCfg      config.ElasticsearchConfig
 	tikaClient *tika.Client // 新增依赖
 }
 
 // NewDocumentService 创建一个新的 DocumentService 实例。
-func NewDocumentService(uploadRepo repository.UploadRepository, userRepo repository.UserRepository, orgTagRepo repository.OrgTagRepository, minioCfg config.MinIOConfig, tikaClient *tika.Client) DocumentService {
+func NewDocumentService(uploadRepo repository.UploadRepository, userRepo repository.UserRepository, orgTagRepo repository.OrgTagRepository, minioCfg config.MinIOConfig, esCfg config.ElasticsearchConfig, tikaClient *tika.Client) DocumentService {
 	return &documentService{
 		uploadRepo: uploadRepo,
 		userRepo:   userRepo,
 		orgTagRepo: orgTagRepo,
 		minioCfg:   minioCfg,
+		esCfg:      esCfg,
 		tikaClient: tikaClient,
 	}
 }
@@ -86,7 +136,92 @@ func (s *documentService) ListUploadedFiles(userID uint) ([]FileUploadDTO, error
 	return dtos, nil
 }
 
-// DeleteDocument 删除一个文档。
+// GetProcessingStatus 获取用户上传的文件的处理进度。
+func (s *documentService) GetProcessingStatus(fileMD5 string, userID uint) (*ProcessingStatusDTO, error) {
+	record, err := s.uploadRepo.GetFileUploadRecord(fileMD5, userID)
+	if err != nil {
+		return nil, errors.New("文件不存在或不属于该用户")
+	}
+	return &ProcessingStatusDTO{
+		FileMD5:      record.FileMD5,
+		FileName:     record.FileName,
+		Status:       record.ProcessingStatus,
+		ChunkCount:   record.ChunkCount,
+		IndexedCount: record.IndexedCount,
+		Error:        record.ProcessingError,
+		UpdatedAt:    record.ProcessingUpdatedAt,
+	}, nil
+}
+
+// ReprocessDocuments 为符合条件的已合并文件重新发送文件处理任务。
+// 秒传共享的文件有多条记录，但分块与向量按 file_md5 存储、Processor 也会更新全部共享记录的状态，
+// 因此每个 file_md5 只发送一个任务，避免同一文件被并发处理多次。
+func (s *documentService) ReprocessDocuments(ctx context.Context, req ReprocessRequest) (*ReprocessResult, error) {
+	if req.FileMD5 == "" && req.UserID == nil && req.OrgTag == "" && !req.Failed {
+		return nil, ErrEmptyReprocessScope
+	}
+	filter := repository.FileUploadFilter{FileMD5: req.FileMD5, UserID: req.UserID, OrgTag: req.OrgTag}
+	if req.Failed {
+		filter.ProcessingStatus = model.ProcessingStatusFailed
+	}
+	files, err := s.uploadRepo.FindMergedFiles(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(files))
+	unique := make([]model.FileUpload, 0, len(files))
+	for _, file := range files {
+		if !seen[file.FileMD5] {
+			seen[file.FileMD5] = true
+			unique = append(unique, file)
+		}
+	}
+
+	result := &ReprocessResult{Matched: len(unique), Failures: []ReprocessFailure{}}
+	for _, file := range unique {
+		if err := s.enqueueProcessing(file); err != nil {
+			log.Errorf("[DocumentService] 重新处理文件入队失败, fileMD5: %s, userID: %d, error: %v", file.FileMD5, file.UserID, err)
+			result.Failures = append(result.Failures, ReprocessFailure{FileMD5: file.FileMD5, UserID: file.UserID, Error: err.Error()})
+			continue
+		}
+		result.Queued++
+	}
+	log.Infof("[DocumentService] 重新处理文件: 匹配 %d 个, 入队 %d 个", result.Matched, result.Queued)
+	return result, nil
+}
+
+// enqueueProcessing 将共享该文件内容的全部记录置为排队中，并发送文件处理任务。
+func (s *documentService) enqueueProcessing(file model.FileUpload) error {
+	objectKey := file.StorageKey()
+	objectURL, err := storage.GetPresignedURL(s.minioCfg.BucketName, objectKey, time.Hour)
+	if err != nil {
+		return fmt.Errorf("生成文件访问链接失败: %w", err)
+	}
+	if err := s.uploadRepo.UpdateSharedProcessingState(file.FileMD5, model.ProcessingState{Status: model.ProcessingStatusQueued}); err != nil {
+		return fmt.Errorf("更新处理状态失败: %w", err)
+	}
+	task := tasks.FileProcessingTask{
+		FileMD5:   file.FileMD5,
+		ObjectUrl: objectURL,
+		ObjectKey: objectKey,
+		FileName:  file.FileName,
+		UserID:    file.UserID,
+		OrgTag:    file.OrgTag,
+		IsPublic:  file.IsPublic,
+	}
+	if err := kafka.ProduceFileTask(task); err != nil {
+		failed := model.ProcessingState{Status: model.ProcessingStatusFailed, Error: fmt.Sprintf("发送文件处理任务失败: %v", err)}
+		if updateErr := s.uploadRepo.UpdateSharedProcessingState(file.FileMD5, failed); updateErr != nil {
+			log.Warnf("[DocumentService] 记录文件处理失败状态时出错, fileMD5: %s, error: %v", file.FileMD5, updateErr)
+		}
+		return fmt.Errorf("发送文件处理任务失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteDocument 删除一个文档，依次清理 Elasticsearch 分块、MySQL 记录和 MinIO 对象。
+// 删除前先写入一条待删除记录，任一步失败时该记录保留，由 ReconcilePendingDeletions 重试。
 func (s *documentService) DeleteDocument(fileMD5 string, user *model.User) error {
 	record, err := s.uploadRepo.GetFileUploadRecord(fileMD5, user.ID)
 	if err != nil {
@@ -97,19 +232,185 @@ func (s *documentService) DeleteDocument(fileMD5 string, user *model.User) error
 		return errors.New("没有权限删除此文件")
 	}
 
-	objectName := fmt.Sprintf("merged/%s", record.FileName)
-	err = storage.MinioClient.RemoveObject(context.Background(), s.minioCfg.BucketName, objectName, minio.RemoveObjectOptions{})
+	ctx := context.Background()
+	deletion := &model.DocumentDeletion{
+		FileMD5:    fileMD5,
+		UserID:     record.UserID,
+		ObjectName: record.StorageKey(),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.uploadRepo.SavePendingDeletion(ctx, deletion); err != nil {
+		log.Errorf("[DocumentService] 写入待删除记录失败, fileMD5: %s, error: %v", fileMD5, err)
+		return fmt.Errorf("删除文档失败: %w", err)
+	}
+
+	if err := s.purgeDocument(ctx, deletion); err != nil {
+		log.Warnf("[DocumentService] 删除文档未完全完成，已交由对账任务重试, fileMD5: %s, error: %v", fileMD5, err)
+		// MySQL 记录仍在时删除对用户不可见，需要如实返回错误
+		if _, getErr := s.uploadRepo.GetFileUploadRecord(fileMD5, record.UserID); getErr == nil {
+			return fmt.Errorf("删除文档失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// purgeDocument 执行一次完整的删除。每一步都是幂等的，可被对账任务重复调用。
+// 同一内容被其他用户秒传共享时，只移除当前用户的记录与检索权限，分块、向量与合并文件保留给其余所有者；
+// 合并文件在没有任何记录引用时才删除。成功后移除待删除记录，失败时更新记录中的重试次数与错误信息。
+func (s *documentService) purgeDocument(ctx context.Context, deletion *model.DocumentDeletion) error {
+	var errs []error
+
+	files, err := s.uploadRepo.FindBatchByMD5s([]string{deletion.FileMD5})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("查询文件的其他所有者失败: %w", err))
+		return s.finishPurge(ctx, deletion, errs)
+	}
+	others := make([]*model.FileUpload, 0, len(files))
+	for _, f := range files {
+		if f.UserID != deletion.UserID {
+			others = append(others, f)
+		}
+	}
+	remaining, shared := model.GroupOwners(others)[deletion.FileMD5]
+
+	// 1. 先处理 ES 分块，使文档立即从检索结果中消失：仍有其他所有者时只移除当前用户的权限
+	if shared {
+		updated, err := es.UpdateOwners(ctx, s.esCfg.IndexName, deletion.FileMD5, remaining)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("更新 Elasticsearch 分块所有者失败: %w", err))
+		} else {
+			log.Infof("[DocumentService] 文件仍被 %d 个用户共享，已更新 %d 个分块的所有者, fileMD5: %s", len(remaining.UserIDs), updated, deletion.FileMD5)
+		}
+	} else {
+		deleted, err := es.DeleteByFileMD5(ctx, s.esCfg.IndexName, deletion.FileMD5)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("删除 Elasticsearch 分块失败: %w", err))
+		} else {
+			log.Infof("[DocumentService] 已从 Elasticsearch 删除 %d 个分块, fileMD5: %s", deleted, deletion.FileMD5)
+		}
+	}
+
+	// 2. 删除 MySQL 中的文件记录；最后一个所有者删除时一并删除分片与向量记录
+	if err := s.uploadRepo.DeleteFileUploadRecord(deletion.FileMD5, deletion.UserID); err != nil {
+		errs = append(errs, err)
+	} else if !shared {
+		if err := s.uploadRepo.DeleteFileContentRecords(deletion.FileMD5); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// 3. 合并文件不再被任何记录引用时才从 MinIO 删除
+	refs, err := s.uploadRepo.CountObjectReferences(deletion.ObjectName)
 	if err != nil {
-		// Log or ignore error, but proceed to delete DB record
+		errs = append(errs, fmt.Errorf("统计对象 %s 的引用数失败: %w", deletion.ObjectName, err))
+	} else if refs == 0 {
+		err = storage.MinioClient.RemoveObject(ctx, s.minioCfg.BucketName, deletion.ObjectName, minio.RemoveObjectOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("删除 MinIO 对象 %s 失败: %w", deletion.ObjectName, err))
+		}
+	} else {
+		log.Infof("[DocumentService] 对象仍被 %d 条记录引用，保留: %s", refs, deletion.ObjectName)
 	}
 
-	// 从数据库删除记录()
-	return s.uploadRepo.DeleteFileUploadRecord(fileMD5, record.UserID)
+	return s.finishPurge(ctx, deletion, errs)
 }
 
-// GenerateDownloadURL 生成文件的临时下载链接。
-func (s *documentService) GenerateDownloadURL(fileName string, user *model.User) (*DownloadInfoDTO, error) {
-	// 这是一个简化的实现，假设文件名是唯一的。生产环境需要更复杂的逻辑。
+// finishPurge 在删除全部完成时移除待删除记录，否则更新重试次数与错误信息，超过上限后放弃。
+func (s *documentService) finishPurge(ctx context.Context, deletion *model.DocumentDeletion, errs []error) error {
+	if len(errs) == 0 {
+		return s.uploadRepo.RemovePendingDeletion(ctx, deletion.FileMD5, deletion.UserID)
+	}
+
+	joined := errors.Join(errs...)
+	deletion.Attempts++
+	deletion.LastError = joined.Error()
+	if deletion.Attempts >= maxDeletionAttempts {
+		log.Errorf("[DocumentService] 文档删除重试 %d 次仍失败，放弃重试, fileMD5: %s, userID: %d, error: %v", deletion.Attempts, deletion.FileMD5, deletion.UserID, joined)
+		_ = s.uploadRepo.RemovePendingDeletion(ctx, deletion.FileMD5, deletion.UserID)
+	} else if err := s.uploadRepo.SavePendingDeletion(ctx, deletion); err != nil {
+		log.Errorf("[DocumentService] 更新待删除记录失败, fileMD5: %s, error: %v", deletion.FileMD5, err)
+	}
+	return joined
+}
+
+// ReconcilePendingDeletions 重试所有未完成的文档删除，返回本轮成功完成的数量。
+func (s *documentService) ReconcilePendingDeletions(ctx context.Context) (int, error) {
+	deletions, err := s.uploadRepo.ListPendingDeletions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	completed := 0
+	for _, d := range deletions {
+		if ctx.Err() != nil {
+			return completed, ctx.Err()
+		}
+		if err := s.purgeDocument(ctx, d); err != nil {
+			log.Warnf("[DocumentService] 对账重试删除失败, fileMD5: %s, attempts: %d, error: %v", d.FileMD5, d.Attempts, err)
+			continue
+		}
+		completed++
+	}
+	if len(deletions) > 0 {
+		log.Infof("[DocumentService] 删除对账完成, 待处理: %d, 本轮完成: %d", len(deletions), completed)
+	}
+	return completed, nil
+}
+
+// MigrateObjectKeys 将旧版本按文件名保存的合并文件复制到按用户与 MD5 命名的对象键，并更新记录。
+// 同名文件的所有记录都迁移成功后才删除旧对象；旧对象已被同名文件覆盖时，各记录拿到的是最后写入的内容。
+// 可重复执行，返回本次迁移的记录数。
+func (s *documentService) MigrateObjectKeys(ctx context.Context) (int, error) {
+	files, err := s.uploadRepo.FindMergedFiles(repository.FileUploadFilter{MissingObjectKey: true})
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	byName := make(map[string][]model.FileUpload)
+	for _, file := range files {
+		byName[file.FileName] = append(byName[file.FileName], file)
+	}
+
+	migrated := 0
+	for fileName, group := range byName {
+		if ctx.Err() != nil {
+			return migrated, ctx.Err()
+		}
+		legacyKey := model.LegacyMergedObjectKey(fileName)
+		allMigrated := true
+		for _, file := range group {
+			objectKey := model.MergedObjectKey(file.UserID, file.FileMD5)
+			src := minio.CopySrcOptions{Bucket: s.minioCfg.BucketName, Object: legacyKey}
+			dst := minio.CopyDestOptions{Bucket: s.minioCfg.BucketName, Object: objectKey}
+			// ComposeObject 支持超过 5GB 的单个源对象，CopyObject 不支持
+			if _, err := storage.MinioClient.ComposeObject(ctx, dst, src); err != nil {
+				log.Errorf("[DocumentService] 迁移合并文件失败, %s -> %s, error: %v", legacyKey, objectKey, err)
+				allMigrated = false
+				continue
+			}
+			if err := s.uploadRepo.UpdateObjectKey(file.ID, objectKey); err != nil {
+				log.Errorf("[DocumentService] 更新文件对象键失败, id: %d, error: %v", file.ID, err)
+				allMigrated = false
+				continue
+			}
+			migrated++
+		}
+		if !allMigrated {
+			continue
+		}
+		if err := storage.MinioClient.RemoveObject(ctx, s.minioCfg.BucketName, legacyKey, minio.RemoveObjectOptions{}); err != nil {
+			log.Warnf("[DocumentService] 删除旧合并文件 %s 失败: %v", legacyKey, err)
+		}
+	}
+	log.Infof("[DocumentService] 合并文件对象键迁移完成, 待迁移: %d, 本次迁移: %d", len(files), migrated)
+	return migrated, nil
+}
+
+// findAccessibleFile 在用户可访问的文件中按文件名查找，fileMD5 非空时按 MD5 精确匹配；
+// 存在多个同名文件时优先返回用户自己上传的。
+func (s *documentService) findAccessibleFile(fileName, fileMD5 string, user *model.User) (*model.FileUpload, error) {
 	files, err := s.ListAccessibleFiles(user)
 	if err != nil {
 		return nil, err
@@ -117,20 +418,39 @@ func (s *documentService) GenerateDownloadURL(fileName string, user *model.User)
 
 	var targetFile *model.FileUpload
 	for i := range files {
-		if files[i].FileName == fileName {
+		if fileMD5 != "" && files[i].FileMD5 != fileMD5 {
+			continue
+		}
+		if fileMD5 == "" && files[i].FileName != fileName {
+			continue
+		}
+		if files[i].UserID == user.ID {
+			return &files[i], nil
+		}
+		if targetFile == nil {
 			targetFile = &files[i]
-			break
 		}
 	}
 
 	if targetFile == nil {
 		return nil, errors.New("文件不存在或无权访问")
 	}
+	return targetFile, nil
+}
+
+// GenerateDownloadURL 生成文件的临时下载链接。
+func (s *documentService) GenerateDownloadURL(fileName, fileMD5 string, user *model.User) (*DownloadInfoDTO, error) {
+	targetFile, err := s.findAccessibleFile(fileName, fileMD5, user)
+	if err != nil {
+		return nil, err
+	}
 
-	// 生成预签名的 URL，有效期为1小时
+	// 生成预签名的 URL，有效期为1小时。对象键不含文件名，通过响应头指定下载时的文件名
 	expiry := time.Hour
-	objectName := fmt.Sprintf("uploads/%d/%s", targetFile.UserID, targetFile.FileName)
-	presignedURL, err := storage.MinioClient.PresignedGetObject(context.Background(), s.minioCfg.BucketName, objectName, expiry, url.Values{})
+	objectName := targetFile.StorageKey()
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(targetFile.FileName)))
+	presignedURL, err := storage.MinioClient.PresignedGetObject(context.Background(), s.minioCfg.BucketName, objectName, expiry, params)
 	if err != nil {
 		return nil, err
 	}
@@ -143,28 +463,15 @@ func (s *documentService) GenerateDownloadURL(fileName string, user *model.User)
 }
 
 // GetFilePreviewContent 获取文件的纯文本预览内容。
-func (s *documentService) GetFilePreviewContent(fileName string, user *model.User) (*PreviewInfoDTO, error) {
-	// 权限检查逻辑与下载类似
-	files, err := s.ListAccessibleFiles(user)
+func (s *documentService) GetFilePreviewContent(fileName, fileMD5 string, user *model.User) (*PreviewInfoDTO, error) {
+	// 权限检查逻辑与下载一致
+	targetFile, err := s.findAccessibleFile(fileName, fileMD5, user)
 	if err != nil {
 		return nil, err
 	}
 
-	var targetFile *model.FileUpload
-	for i := range files {
-		if files[i].FileName == fileName {
-			targetFile = &files[i]
-			break
-		}
-	}
-
-	if targetFile == nil {
-		return nil, errors.New("文件不存在或无权访问")
-	}
-
 	// 从 MinIO 获取文件对象
-	//objectName := fmt.Sprintf("uploads/%d/%s", targetFile.UserID, targetFile.FileName)
-	objectName := fmt.Sprintf("merged/%s", targetFile.FileName)
+	objectName := targetFile.StorageKey()
 	object, err := storage.MinioClient.GetObject(context.Background(), s.minioCfg.BucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
 		return nil, err
@@ -172,7 +479,7 @@ func (s *documentService) GetFilePreviewContent(fileName string, user *model.Use
 	defer object.Close()
 
 	// 将文件流发送给 Tika 进行文本提取
-	content, err := s.tikaClient.ExtractText(object, fileName)
+	content, err := s.tikaClient.ExtractText(object, targetFile.FileName)
 	if err != nil {
 		return nil, err
 	}
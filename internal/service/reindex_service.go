@@ -0,0 +1,506 @@
+// Package service 包含了应用的业务逻辑层。
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pai-smart-go/internal/config"
+	"pai-smart-go/internal/model"
+	"pai-smart-go/internal/pipeline"
+	"pai-smart-go/internal/repository"
+	"pai-smart-go/pkg/embedding"
+	"pai-smart-go/pkg/es"
+	"pai-smart-go/pkg/log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// reindexPageSize 是每次从 document_vectors 读取并重新向量化的记录数。
+	reindexPageSize = 500
+	// reindexLockTTL 是任务锁的过期时间，任务每处理一页续期一次。
+	reindexLockTTL = 10 * time.Minute
+	// reindexCleanupTimeout 是任务结束（包括因服务关闭而取消）后保存状态与清理新索引的时限。
+	reindexCleanupTimeout = 30 * time.Second
+)
+
+// ErrReindexRunning 表示已有重建索引任务在运行。
+var ErrReindexRunning = errors.New("已有重建索引任务在运行")
+
+// ReindexRequest 描述重建索引使用的目标 embedding 模型，留空的字段沿用当前配置。
+type ReindexRequest struct {
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
+}
+
+// ReindexService 定义了无停机重建向量索引的操作。
+type ReindexService interface {
+	StartReindex(ctx context.Context, req ReindexRequest) (*model.ReindexJob, error)
+	GetReindexJob(ctx context.Context, jobID string) (*model.ReindexJob, error)
+	GetLatestReindexJob(ctx context.Context) (*model.ReindexJob, error)
+	// RecoverInterruptedJob 将运行实例已退出（任务锁已失效）但仍处于 running 的任务标记为失败并清理新索引。
+	RecoverInterruptedJob(ctx context.Context) error
+	// Stop 取消本实例上正在运行的任务并等待其记录失败状态，用于服务关闭。
+	Stop(ctx context.Context)
+}
+
+type reindexService struct {
+	embeddingClient *embedding.SwitchableClient
+	esCfg           config.ElasticsearchConfig
+	docVectorRepo   repository.DocumentVectorRepository
+	uploadRepo      repository.UploadRepository
+	reindexRepo     repository.ReindexRepository
+
+	// jobCtx 是后台任务的生命周期，独立于触发任务的 HTTP 请求，由 Stop 取消
+	jobCtx    context.Context
+	cancelJob context.CancelFunc
+	jobs      sync.WaitGroup
+}
+
+// NewReindexService 创建一个新的 ReindexService 实例。
+// embeddingClient 应与检索、文件处理共用，以便别名切换后它们同时改用新模型。
+func NewReindexService(embeddingClient *embedding.SwitchableClient, esCfg config.ElasticsearchConfig, docVectorRepo repository.DocumentVectorRepository, uploadRepo repository.UploadRepository, reindexRepo repository.ReindexRepository) ReindexService {
+	jobCtx, cancelJob := context.WithCancel(context.Background())
+	return &reindexService{
+		embeddingClient: embeddingClient,
+		esCfg:           esCfg,
+		docVectorRepo:   docVectorRepo,
+		uploadRepo:      uploadRepo,
+		reindexRepo:     reindexRepo,
+		jobCtx:          jobCtx,
+		cancelJob:       cancelJob,
+	}
+}
+
+// StartReindex 创建重建索引任务并在后台运行，立即返回任务的初始状态。
+func (s *reindexService) StartReindex(ctx context.Context, req ReindexRequest) (*model.ReindexJob, error) {
+	current := s.embeddingClient.Config()
+	if req.Model == "" {
+		req.Model = current.Model
+	}
+	if req.Dimensions == 0 {
+		req.Dimensions = current.Dimensions
+	}
+	if req.Dimensions < 0 {
+		return nil, fmt.Errorf("无效的向量维度: %d", req.Dimensions)
+	}
+
+	if s.jobCtx.Err() != nil {
+		return nil, errors.New("服务正在关闭，无法启动重建索引任务")
+	}
+
+	now := time.Now()
+	job := &model.ReindexJob{
+		JobID:      strconv.FormatInt(now.UnixNano(), 10),
+		Status:     model.ReindexStatusRunning,
+		Alias:      s.esCfg.IndexName,
+		Model:      req.Model,
+		Dimensions: req.Dimensions,
+		StartedAt:  now,
+	}
+	acquired, err := s.reindexRepo.AcquireLock(ctx, job.JobID, reindexLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrReindexRunning
+	}
+	if err := s.reindexRepo.SaveJob(ctx, job); err != nil {
+		_ = s.reindexRepo.ReleaseLock(ctx, job.JobID)
+		return nil, err
+	}
+
+	snapshot := *job
+	s.jobs.Add(1)
+	go s.run(s.jobCtx, job)
+	return &snapshot, nil
+}
+
+// Stop 取消正在运行的任务，并在 ctx 到期前等待其保存失败状态、清理未切换的新索引。
+func (s *reindexService) Stop(ctx context.Context) {
+	s.cancelJob()
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("[Reindex] 等待重建索引任务退出超时")
+	}
+}
+
+// RecoverInterruptedJob 检查最近一次任务：仍为 running 但任务锁已不由它持有，说明运行它的实例已异常退出
+// （锁在最后一次续期后 reindexLockTTL 内过期）。此时将任务标记为失败；别名尚未切换时删除新索引，
+// 已切换时保留新索引，但切换后新增分块的补齐可能未完成，需要重新发起重建。
+func (s *reindexService) RecoverInterruptedJob(ctx context.Context) error {
+	job, err := s.reindexRepo.GetLatestJob(ctx)
+	if errors.Is(err, repository.ErrReindexJobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if job.Status != model.ReindexStatusRunning {
+		return nil
+	}
+	held, err := s.reindexRepo.IsLockHeld(ctx, job.JobID)
+	if err != nil || held {
+		return err
+	}
+
+	job.Status = model.ReindexStatusFailed
+	job.Error = "运行任务的服务实例已退出，任务中断"
+	if job.TargetIndex != "" {
+		current, _, err := es.ResolveIndex(ctx, job.Alias)
+		if err != nil {
+			return fmt.Errorf("解析别名 '%s' 失败: %w", job.Alias, err)
+		}
+		swapped := false
+		for _, index := range current {
+			if index == job.TargetIndex {
+				swapped = true
+			}
+		}
+		if swapped {
+			job.Error += "；别名已切换到新索引，但切换后新增分块的补齐可能未完成，请重新发起重建"
+		} else if err := es.DeleteIndex(ctx, job.TargetIndex); err != nil {
+			return fmt.Errorf("清理中断任务的新版本索引 '%s' 失败: %w", job.TargetIndex, err)
+		}
+	}
+	finished := time.Now()
+	job.FinishedAt = &finished
+	log.Warnf("[Reindex] 任务 %s 已中断，标记为失败: %s", job.JobID, job.Error)
+	return s.reindexRepo.SaveJob(ctx, job)
+}
+
+// GetReindexJob 返回指定任务的状态与进度。
+func (s *reindexService) GetReindexJob(ctx context.Context, jobID string) (*model.ReindexJob, error) {
+	return s.reindexRepo.GetJob(ctx, jobID)
+}
+
+// GetLatestReindexJob 返回最近一次任务的状态与进度。
+func (s *reindexService) GetLatestReindexJob(ctx context.Context) (*model.ReindexJob, error) {
+	return s.reindexRepo.GetLatestJob(ctx)
+}
+
+// run 执行任务并记录最终状态，结束后释放任务锁。
+// 任务可能因服务关闭而被取消，收尾操作使用独立的上下文，确保失败状态被记录、锁被释放。
+func (s *reindexService) run(ctx context.Context, job *model.ReindexJob) {
+	defer s.jobs.Done()
+	err := s.execute(ctx, job)
+
+	finishCtx, cancel := context.WithTimeout(context.Background(), reindexCleanupTimeout)
+	defer cancel()
+	defer func() {
+		if err := s.reindexRepo.ReleaseLock(finishCtx, job.JobID); err != nil {
+			log.Errorf("[Reindex] 释放任务锁失败, jobId: %s, error: %v", job.JobID, err)
+		}
+	}()
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		log.Errorf("[Reindex] 任务失败, jobId: %s, error: %v", job.JobID, err)
+		job.Status = model.ReindexStatusFailed
+		job.Error = err.Error()
+		if ctx.Err() != nil {
+			job.Error = "服务关闭，任务已中断: " + job.Error
+		}
+	} else {
+		log.Infof("[Reindex] 任务完成, jobId: %s, 别名 '%s' -> '%s', 模型: %s", job.JobID, job.Alias, job.TargetIndex, job.Model)
+		job.Status = model.ReindexStatusSucceeded
+	}
+	if err := s.reindexRepo.SaveJob(finishCtx, job); err != nil {
+		log.Errorf("[Reindex] 保存任务状态失败, jobId: %s, error: %v", job.JobID, err)
+	}
+}
+
+// execute 依次完成：创建新版本索引 -> 全量重新向量化写入 -> 按 MySQL 核对新索引 -> 原子切换别名与 embedding 模型
+// -> 补齐切换前新增的分块并再次核对。新索引在 _meta 中记录所用模型，重启时据此校验配置。
+// 重建期间的删除与所有者变更经影子别名同时写入新索引；它们与正在复制的分页存在竞争，由核对步骤修正。
+// 切换前任一步失败都会删除新索引，别名保持指向旧索引，检索不受影响。
+func (s *reindexService) execute(ctx context.Context, job *model.ReindexJob) error {
+	targetCfg := s.embeddingClient.Config()
+	targetCfg.Model = job.Model
+	targetCfg.Dimensions = job.Dimensions
+	client := embedding.NewClient(targetCfg)
+
+	total, err := s.docVectorRepo.Count()
+	if err != nil {
+		return fmt.Errorf("统计分块数量失败: %w", err)
+	}
+	job.Total = total
+
+	sources, isAlias, err := es.ResolveIndex(ctx, job.Alias)
+	if err != nil {
+		return fmt.Errorf("解析别名 '%s' 失败: %w", job.Alias, err)
+	}
+	job.SourceIndices = sources
+
+	targetIndex, err := es.CreateVersionedIndex(ctx, job.Alias, job.Model, job.Dimensions)
+	if err != nil {
+		return fmt.Errorf("创建新版本索引失败: %w", err)
+	}
+	job.TargetIndex = targetIndex
+	s.saveProgress(ctx, job)
+	log.Infof("[Reindex] 开始重建, jobId: %s, 源索引: %v, 目标索引: %s, 模型: %s, 维度: %d, 分块总数: %d",
+		job.JobID, sources, targetIndex, job.Model, job.Dimensions, total)
+
+	lastID, err := s.copyDocuments(ctx, job, client, targetCfg, 0)
+	if err == nil {
+		// 新索引中的分块数与 MySQL 逐文件一致后才切换别名
+		err = s.reconcileIndex(ctx, job, targetIndex, lastID)
+	}
+	if err == nil {
+		err = es.SwapAlias(ctx, job.Alias, targetIndex)
+	}
+	if err != nil {
+		// ctx 可能已因服务关闭而取消，清理使用独立的上下文
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), reindexCleanupTimeout)
+		defer cancel()
+		if delErr := es.DeleteIndex(cleanupCtx, targetIndex); delErr != nil {
+			log.Errorf("[Reindex] 清理新版本索引 '%s' 失败: %v", targetIndex, delErr)
+		}
+		return err
+	}
+	// 别名已指向新向量，检索与文件处理随即改用新模型
+	s.embeddingClient.Switch(targetCfg)
+	log.Warnf("[Reindex] embedding 模型已切换为 %s (维度 %d)，请同步更新配置文件中的 embedding.model 与 embedding.dimensions，否则重启时索引校验将拒绝启动", job.Model, job.Dimensions)
+
+	// 补齐全量阶段结束后、切换前新写入的分块（它们仍由旧模型向量化并写入了旧索引）
+	if lastID, err = s.copyDocuments(ctx, job, client, targetCfg, lastID); err != nil {
+		return fmt.Errorf("补齐切换期间新增的分块失败: %w", err)
+	}
+	// 核对失败时不删除此前的版本索引（别名已不再指向它们），以便排查与恢复
+	if err := s.reconcileIndex(ctx, job, targetIndex, lastID); err != nil {
+		return fmt.Errorf("核对新索引失败: %w", err)
+	}
+	if lastID > 0 {
+		if err := s.docVectorRepo.UpdateModelVersionThrough(lastID, job.Model); err != nil {
+			log.Errorf("[Reindex] 更新 document_vectors 模型版本失败: %v", err)
+		}
+	}
+
+	// 旧部署的普通索引已在切换别名时删除；这里清理此前的版本索引
+	if isAlias {
+		for _, index := range sources {
+			if index == targetIndex {
+				continue
+			}
+			if err := es.DeleteIndex(ctx, index); err != nil {
+				log.Errorf("[Reindex] 删除旧索引 '%s' 失败: %v", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyDocuments 从 afterID 之后按页读取分块，用新模型向量化并写入目标索引，返回处理到的最大 vector_id。
+func (s *reindexService) copyDocuments(ctx context.Context, job *model.ReindexJob, client embedding.Client, cfg config.EmbeddingConfig, afterID uint) (uint, error) {
+	indexer, err := es.NewBulkIndexer(job.TargetIndex)
+	if err != nil {
+		return afterID, err
+	}
+
+	lastID := afterID
+	for {
+		docs, err := s.docVectorRepo.FindAfterID(lastID, reindexPageSize)
+		if err != nil {
+			_, _ = indexer.Close(ctx)
+			return lastID, fmt.Errorf("读取分块失败: %w", err)
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		vectors, err := pipeline.EmbedDocuments(ctx, client, cfg, docs)
+		if err != nil {
+			_, _ = indexer.Close(ctx)
+			return lastID, fmt.Errorf("向量化失败: %w", err)
+		}
+		owners, err := s.loadOwners(docs)
+		if err != nil {
+			_, _ = indexer.Close(ctx)
+			return lastID, err
+		}
+		for i, doc := range docs {
+			docOwners, ok := owners[doc.FileMD5]
+			if !ok {
+				// 所有者记录已被删除的分块按处理时的所有者写入，随后的删除会将其一并清理
+				docOwners = model.DocumentOwners{UserIDs: model.UintList{doc.UserID}, OrgTags: model.StringList{doc.OrgTag}, IsPublic: doc.IsPublic}
+			}
+			esDoc := model.EsDocument{
+				VectorID:     fmt.Sprintf("%s_%d", doc.FileMD5, doc.ChunkID),
+				FileMD5:      doc.FileMD5,
+				ChunkID:      doc.ChunkID,
+				TextContent:  doc.TextContent,
+				Vector:       vectors[i],
+				ModelVersion: job.Model,
+				UserID:       docOwners.UserIDs,
+				OrgTag:       docOwners.OrgTags,
+				IsPublic:     docOwners.IsPublic,
+				FileType:     docOwners.FileType,
+				UploadedAt:   docOwners.UploadedAt,
+			}
+			if err := indexer.Add(ctx, esDoc); err != nil {
+				_, _ = indexer.Close(ctx)
+				return lastID, fmt.Errorf("添加分块到批量索引队列失败: %w", err)
+			}
+		}
+
+		lastID = docs[len(docs)-1].VectorID
+		job.Processed += int64(len(docs))
+		if job.Processed > job.Total {
+			job.Total = job.Processed
+		}
+		s.saveProgress(ctx, job)
+		if err := s.reindexRepo.RefreshLock(ctx, job.JobID, reindexLockTTL); err != nil {
+			_, _ = indexer.Close(ctx)
+			return lastID, err
+		}
+	}
+
+	result, err := indexer.Close(ctx)
+	if err != nil {
+		return lastID, fmt.Errorf("批量索引到 Elasticsearch 失败: %w", err)
+	}
+	if len(result.Failures) > 0 {
+		return lastID, fmt.Errorf("%d 个分块索引失败, 首个错误: %s", len(result.Failures), result.Failures[0].Reason)
+	}
+	return lastID, nil
+}
+
+// reconcileIndex 按 MySQL 中 vector_id 不超过 maxID 的分块核对索引：删除已不存在的文件与重新分块后多出的分块，
+// 修正所有者；随后校验每个仍有所有者的文件在索引中的分块数与 MySQL 完全一致，缺少分块或整个文件时返回错误，
+// 避免切换别名、删除旧索引后检索永久丢失数据。调用前索引须已 refresh（批量写入结束时会统一 refresh）。
+func (s *reindexService) reconcileIndex(ctx context.Context, job *model.ReindexJob, indexName string, maxID uint) error {
+	var deleted, trimmed, updated int
+	err := es.ScanFiles(ctx, indexName, reindexPageSize, func(files []es.FileSummary) error {
+		md5s := make([]string, len(files))
+		for i, f := range files {
+			md5s[i] = f.FileMD5
+		}
+		counts, err := s.docVectorRepo.CountByFileMD5s(md5s, maxID)
+		if err != nil {
+			return fmt.Errorf("统计分块数量失败: %w", err)
+		}
+		uploads, err := s.uploadRepo.FindBatchByMD5s(md5s)
+		if err != nil {
+			return fmt.Errorf("查询文件所有者失败: %w", err)
+		}
+		owners := model.GroupOwners(uploads)
+
+		for _, f := range files {
+			chunks := counts[f.FileMD5]
+			current, ok := owners[f.FileMD5]
+			if !ok || chunks == 0 {
+				if _, err := es.DeleteByFileMD5(ctx, indexName, f.FileMD5); err != nil {
+					return err
+				}
+				deleted++
+				continue
+			}
+			if f.Chunks > chunks {
+				if _, err := es.DeleteChunksFrom(ctx, indexName, f.FileMD5, int(chunks)); err != nil {
+					return err
+				}
+				trimmed++
+			}
+			if !f.Owners.Equal(current) {
+				if _, err := es.UpdateOwners(ctx, indexName, f.FileMD5, current); err != nil {
+					return err
+				}
+				updated++
+			}
+		}
+		return s.reindexRepo.RefreshLock(ctx, job.JobID, reindexLockTTL)
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("[Reindex] 核对索引 '%s' 完成, 删除文件: %d, 清理多余分块的文件: %d, 修正所有者: %d", indexName, deleted, trimmed, updated)
+	return s.verifyIndex(ctx, job, indexName, maxID)
+}
+
+// verifyIndex 按文件遍历 MySQL 中 vector_id 不超过 maxID 的分块，校验每个仍有所有者的文件在索引中的分块数与之相等。
+func (s *reindexService) verifyIndex(ctx context.Context, job *model.ReindexJob, indexName string, maxID uint) error {
+	var files, expected int64
+	var incomplete []string
+	after := ""
+	for {
+		page, err := s.docVectorRepo.CountFilesAfter(after, maxID, reindexPageSize)
+		if err != nil {
+			return fmt.Errorf("统计分块数量失败: %w", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		after = page[len(page)-1].FileMD5
+
+		md5s := make([]string, len(page))
+		for i, f := range page {
+			md5s[i] = f.FileMD5
+		}
+		uploads, err := s.uploadRepo.FindBatchByMD5s(md5s)
+		if err != nil {
+			return fmt.Errorf("查询文件所有者失败: %w", err)
+		}
+		owners := model.GroupOwners(uploads)
+		indexed, err := es.CountFiles(ctx, indexName, md5s)
+		if err != nil {
+			return err
+		}
+		for _, f := range page {
+			// 已删除（或正在删除）的文件不要求出现在新索引中
+			if _, ok := owners[f.FileMD5]; !ok {
+				continue
+			}
+			files++
+			expected += f.Count
+			if indexed[f.FileMD5] != f.Count {
+				incomplete = append(incomplete, fmt.Sprintf("%s(%d/%d)", f.FileMD5, indexed[f.FileMD5], f.Count))
+			}
+		}
+		if err := s.reindexRepo.RefreshLock(ctx, job.JobID, reindexLockTTL); err != nil {
+			return err
+		}
+	}
+	if len(incomplete) > 0 {
+		shown := incomplete
+		if len(shown) > 5 {
+			shown = shown[:5]
+		}
+		return fmt.Errorf("新索引 '%s' 中 %d 个文件的分块数与 MySQL 不一致（已索引/应有）: %s", indexName, len(incomplete), strings.Join(shown, ", "))
+	}
+	log.Infof("[Reindex] 校验索引 '%s' 完成, 文件: %d, 分块: %d", indexName, files, expected)
+	return nil
+}
+
+// loadOwners 读取一页分块所属文件的全部所有者，键为 file_md5。
+func (s *reindexService) loadOwners(docs []*model.DocumentVector) (map[string]model.DocumentOwners, error) {
+	seen := make(map[string]struct{})
+	md5s := make([]string, 0)
+	for _, doc := range docs {
+		if _, ok := seen[doc.FileMD5]; !ok {
+			seen[doc.FileMD5] = struct{}{}
+			md5s = append(md5s, doc.FileMD5)
+		}
+	}
+	files, err := s.uploadRepo.FindBatchByMD5s(md5s)
+	if err != nil {
+		return nil, fmt.Errorf("查询文件所有者失败: %w", err)
+	}
+	return model.GroupOwners(files), nil
+}
+
+// saveProgress 保存任务进度，失败只记录日志，不中断任务。
+func (s *reindexService) saveProgress(ctx context.Context, job *model.ReindexJob) {
+	if err := s.reindexRepo.SaveJob(ctx, job); err != nil {
+		log.Warnf("[Reindex] 保存任务进度失败, jobId: %s, error: %v", job.JobID, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Package service 包含了应用的业务逻辑层。
+package service
+
+import "sort"
+
+// fuseRRF 按倒数排名融合多路检索结果：score = Σ weight / (k + rank)，rank 从 1 开始。
+// 同一分块以 vector_id 识别，结果按融合分数从高到低排列。
+func fuseRRF(lists [][]searchHit, weights []float64, k int) []searchHit {
+	return fuse(lists, func(list int, rank int, _ float64) float64 {
+		return weights[list] / float64(k+rank+1)
+	})
+}
+
+// fuseLinear 将每一路的分数按最大最小值归一化到 [0, 1] 后加权求和，分块未出现在某一路时该路计 0。
+// 某一路所有分数相同时，其命中均计 1。
+func fuseLinear(lists [][]searchHit, weights []float64) []searchHit {
+	mins := make([]float64, len(lists))
+	maxs := make([]float64, len(lists))
+	for i, list := range lists {
+		for j, hit := range list {
+			if j == 0 || hit.Score < mins[i] {
+				mins[i] = hit.Score
+			}
+			if j == 0 || hit.Score > maxs[i] {
+				maxs[i] = hit.Score
+			}
+		}
+	}
+	return fuse(lists, func(list int, _ int, score float64) float64 {
+		if maxs[list] == mins[list] {
+			return weights[list]
+		}
+		return weights[list] * (score - mins[list]) / (maxs[list] - mins[list])
+	})
+}
+
+// fuse 累加每个分块在各路中的得分（由 contribution 根据所在路、0 起的排名与原始分数给出），按总分降序返回；
+// 总分相同时保持首次出现的顺序；高亮片段取自带有片段的那一路。
+func fuse(lists [][]searchHit, contribution func(list int, rank int, score float64) float64) []searchHit {
+	index := make(map[string]int)
+	var fused []searchHit
+	for i, list := range lists {
+		for rank, hit := range list {
+			gain := contribution(i, rank, hit.Score)
+			pos, ok := index[hit.Source.VectorID]
+			if !ok {
+				index[hit.Source.VectorID] = len(fused)
+				hit.Score = gain
+				fused = append(fused, hit)
+				continue
+			}
+			fused[pos].Score += gain
+			if fused[pos].Highlight == nil {
+				fused[pos].Highlight = hit.Highlight
+			}
+		}
+	}
+	sort.SliceStable(fused, func(a, b int) bool { return fused[a].Score > fused[b].Score })
+	return fused
+}
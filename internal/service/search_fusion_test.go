@@ -0,0 +1,170 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"pai-smart-go/internal/model"
+)
+
+// hits 按给定顺序构造一路检索结果，ids 与 scores 一一对应。
+func hits(ids []string, scores []float64) []searchHit {
+	list := make([]searchHit, len(ids))
+	for i, id := range ids {
+		list[i] = searchHit{Source: model.EsDocument{VectorID: id}, Score: scores[i]}
+	}
+	return list
+}
+
+// assertFused 校验融合结果的顺序与分数。
+func assertFused(t *testing.T, got []searchHit, wantIDs []string, wantScores []float64) {
+	t.Helper()
+	if len(got) != len(wantIDs) {
+		t.Fatalf("结果数 = %d, 期望 %d", len(got), len(wantIDs))
+	}
+	for i, hit := range got {
+		if hit.Source.VectorID != wantIDs[i] {
+			t.Errorf("第 %d 个结果 = %s, 期望 %s", i, hit.Source.VectorID, wantIDs[i])
+		}
+		if math.IsNaN(hit.Score) || math.Abs(hit.Score-wantScores[i]) > 1e-9 {
+			t.Errorf("%s 的分数 = %v, 期望 %v", hit.Source.VectorID, hit.Score, wantScores[i])
+		}
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		lists      [][]searchHit
+		weights    []float64
+		k          int
+		wantIDs    []string
+		wantScores []float64
+	}{
+		{
+			name: "两路都命中的分块排在前面",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{0.9, 0.8}),
+				hits([]string{"b", "c"}, []float64{12, 7}),
+			},
+			weights:    []float64{1, 1},
+			k:          60,
+			wantIDs:    []string{"b", "a", "c"},
+			wantScores: []float64{1.0/62 + 1.0/61, 1.0 / 61, 1.0 / 62},
+		},
+		{
+			name: "只出现在一路",
+			lists: [][]searchHit{
+				hits([]string{"a"}, []float64{0.9}),
+				nil,
+			},
+			weights:    []float64{1, 1},
+			k:          60,
+			wantIDs:    []string{"a"},
+			wantScores: []float64{1.0 / 61},
+		},
+		{
+			name: "同分时保持首次出现的顺序",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{0.9, 0.8}),
+				hits([]string{"b", "a"}, []float64{12, 7}),
+			},
+			weights:    []float64{1, 1},
+			k:          60,
+			wantIDs:    []string{"a", "b"},
+			wantScores: []float64{1.0/61 + 1.0/62, 1.0/62 + 1.0/61},
+		},
+		{
+			name: "k 为 0 时首位的分数为权重本身",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{0.9, 0.8}),
+			},
+			weights:    []float64{2},
+			k:          0,
+			wantIDs:    []string{"a", "b"},
+			wantScores: []float64{2, 1},
+		},
+		{
+			name: "权重为 0 的一路不影响排序",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{0.9, 0.8}),
+				hits([]string{"b"}, []float64{12}),
+			},
+			weights:    []float64{1, 0},
+			k:          60,
+			wantIDs:    []string{"a", "b"},
+			wantScores: []float64{1.0 / 61, 1.0 / 62},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFused(t, fuseRRF(tt.lists, tt.weights, tt.k), tt.wantIDs, tt.wantScores)
+		})
+	}
+}
+
+func TestFuseLinear(t *testing.T) {
+	tests := []struct {
+		name       string
+		lists      [][]searchHit
+		weights    []float64
+		wantIDs    []string
+		wantScores []float64
+	}{
+		{
+			name: "按最大最小值归一化后加权求和",
+			lists: [][]searchHit{
+				hits([]string{"a", "b", "c"}, []float64{0.9, 0.7, 0.5}),
+				hits([]string{"c", "a"}, []float64{20, 10}),
+			},
+			weights:    []float64{1, 2},
+			wantIDs:    []string{"c", "a", "b"},
+			wantScores: []float64{0 + 2, 1 + 0, 0.5},
+		},
+		{
+			name: "只出现在一路时另一路计 0",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{4, 2}),
+				hits([]string{"c", "d"}, []float64{3, 1}),
+			},
+			weights:    []float64{1, 1},
+			wantIDs:    []string{"a", "c", "b", "d"},
+			wantScores: []float64{1, 1, 0, 0},
+		},
+		{
+			name: "分数全部相同时均计为权重",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{3, 3}),
+				nil,
+			},
+			weights:    []float64{0.5, 1},
+			wantIDs:    []string{"a", "b"},
+			wantScores: []float64{0.5, 0.5},
+		},
+		{
+			name: "只有一个命中时不会除以 0",
+			lists: [][]searchHit{
+				hits([]string{"a"}, []float64{0.3}),
+				hits([]string{"a"}, []float64{8}),
+			},
+			weights:    []float64{1, 1},
+			wantIDs:    []string{"a"},
+			wantScores: []float64{2},
+		},
+		{
+			name: "权重全为 0 时分数为 0 且保持首次出现的顺序",
+			lists: [][]searchHit{
+				hits([]string{"a", "b"}, []float64{0.9, 0.1}),
+				hits([]string{"c"}, []float64{5}),
+			},
+			weights:    []float64{0, 0},
+			wantIDs:    []string{"a", "b", "c"},
+			wantScores: []float64{0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFused(t, fuseLinear(tt.lists, tt.weights), tt.wantIDs, tt.wantScores)
+		})
+	}
+}
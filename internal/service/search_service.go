@@ -5,22 +5,68 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"pai-smart-go/internal/config"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/internal/repository"
 	"pai-smart-go/pkg/embedding"
 	"pai-smart-go/pkg/log"
+	"pai-smart-go/pkg/rerank"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 )
 
+// recallMultiplier 是召回窗口相对 topK 的倍数，与 Java 的 recallK 对齐。
+const recallMultiplier = 30
+
+// facetSize 是每个分面最多返回的取值数。
+const facetSize = 20
+
+// ErrInvalidSearchOptions 表示请求中的检索参数无效。
+var ErrInvalidSearchOptions = errors.New("无效的检索参数")
+
+// SearchOptions 是单次检索可覆盖的排序参数，零值字段沿用 search 配置。
+type SearchOptions struct {
+	// Fusion 是融合策略：rescore、rrf 或 linear
+	Fusion     string
+	KNNWeight  *float64
+	BM25Weight *float64
+	// RRFK 是 RRF 的排名常数
+	RRFK int
+	// DisableRerank 为 true 时跳过重排序，直接按召回分数返回
+	DisableRerank bool
+	// Filters 在权限过滤之外进一步限定检索范围
+	Filters SearchFilters
+	// Facets 为 true 时额外统计命中分块按文件与组织标签的分布
+	Facets bool
+}
+
+// SearchFilters 是检索的可选过滤条件，同一字段内多个取值为“或”，不同字段之间为“且”。
+type SearchFilters struct {
+	FileMD5s  []string
+	OrgTags   []string
+	UserIDs   []uint
+	FileTypes []string // 小写、不带点的扩展名
+	// UploadedFrom 与 UploadedTo 限定上传时间范围，均包含边界
+	UploadedFrom *time.Time
+	UploadedTo   *time.Time
+}
+
+// SearchResult 是一次检索的结果，Facets 仅在请求分面统计时返回。
+type SearchResult struct {
+	Results []model.SearchResponseDTO
+	Facets  *model.SearchFacets
+}
+
 // SearchService 接口定义了搜索操作。
 type SearchService interface {
-	HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error)
+	HybridSearch(ctx context.Context, query string, topK int, user *model.User, opts SearchOptions) (*SearchResult, error)
 }
 
 type searchService struct {
@@ -28,21 +74,81 @@ type searchService struct {
 	esClient        *elasticsearch.Client
 	userService     UserService
 	uploadRepo      repository.UploadRepository // 新增：UploadRepository 依赖
+	esCfg           config.ElasticsearchConfig
+	searchCfg       config.SearchConfig
+	reranker        rerank.Reranker // 为 nil 时不重排序
+	rerankCfg       config.RerankConfig
 }
 
-// NewSearchService 创建一个新的 SearchService 实例。
-func NewSearchService(embeddingClient embedding.Client, esClient *elasticsearch.Client, userService UserService, uploadRepo repository.UploadRepository) SearchService {
+// NewSearchService 创建一个新的 SearchService 实例。reranker 可为 nil，表示不启用重排序。
+func NewSearchService(embeddingClient embedding.Client, esClient *elasticsearch.Client, userService UserService, uploadRepo repository.UploadRepository, esCfg config.ElasticsearchConfig, searchCfg config.SearchConfig, reranker rerank.Reranker, rerankCfg config.RerankConfig) SearchService {
 	return &searchService{
 		embeddingClient: embeddingClient,
 		esClient:        esClient,
 		userService:     userService,
 		uploadRepo:      uploadRepo, // 新增
+		esCfg:           esCfg,
+		searchCfg:       searchCfg,
+		reranker:        reranker,
+		rerankCfg:       rerankCfg,
+	}
+}
+
+// searchHit 是一条检索命中，Score 为所用融合策略下的召回分数，Highlight 为 BM25 一路返回的高亮片段。
+type searchHit struct {
+	Source      model.EsDocument    `json:"_source"`
+	Score       float64             `json:"_score"`
+	Highlight   map[string][]string `json:"highlight"`
+	RerankScore *float64            `json:"-"`
+}
+
+// ranking 是合并配置与请求覆盖后实际使用的排序参数。
+type ranking struct {
+	fusion  string
+	weights config.FusionWeightsConfig
+	rrfK    int
+}
+
+// resolveRanking 合并 search 配置与请求中的覆盖项，并校验参数。
+func (s *searchService) resolveRanking(opts SearchOptions) (ranking, error) {
+	r := ranking{fusion: s.searchCfg.FusionName(), rrfK: s.searchCfg.RRFRankConstant()}
+	if opts.Fusion != "" {
+		r.fusion = opts.Fusion
+	}
+	switch r.fusion {
+	case config.FusionRescore, config.FusionRRF, config.FusionLinear:
+	default:
+		return r, fmt.Errorf("%w: 不支持的融合策略 '%s'，可选 rescore、rrf、linear", ErrInvalidSearchOptions, r.fusion)
+	}
+	r.weights = s.searchCfg.Weights(r.fusion)
+	if opts.KNNWeight != nil {
+		r.weights.KNNWeight = *opts.KNNWeight
+	}
+	if opts.BM25Weight != nil {
+		r.weights.BM25Weight = *opts.BM25Weight
 	}
+	if r.weights.KNNWeight < 0 || r.weights.BM25Weight < 0 {
+		return r, fmt.Errorf("%w: 权重不能为负数", ErrInvalidSearchOptions)
+	}
+	if opts.RRFK < 0 {
+		return r, fmt.Errorf("%w: rrfK 不能为负数", ErrInvalidSearchOptions)
+	}
+	if opts.RRFK > 0 {
+		r.rrfK = opts.RRFK
+	}
+	return r, nil
 }
 
-// HybridSearch 执行两阶段混合搜索。
-func (s *searchService) HybridSearch(ctx context.Context, query string, topK int, user *model.User) ([]model.SearchResponseDTO, error) {
-	log.Infof("[SearchService] 开始执行混合搜索, query: '%s', topK: %d, user: %s", query, topK, user.Username)
+// HybridSearch 执行混合搜索，kNN 与 BM25 两路的融合方式由 search 配置与 opts 决定。
+func (s *searchService) HybridSearch(ctx context.Context, query string, topK int, user *model.User, opts SearchOptions) (*SearchResult, error) {
+	rank, err := s.resolveRanking(opts)
+	if err != nil {
+		return nil, err
+	}
+	if f := opts.Filters; f.UploadedFrom != nil && f.UploadedTo != nil && f.UploadedFrom.After(*f.UploadedTo) {
+		return nil, fmt.Errorf("%w: 上传时间的起始值晚于结束值", ErrInvalidSearchOptions)
+	}
+	log.Infof("[SearchService] 开始执行混合搜索, query: '%s', topK: %d, user: %s, fusion: %s", query, topK, user.Username, rank.fusion)
 
 	// 1. 获取用户有效的组织标签（包含层级关系）
 	log.Info("[SearchService] 步骤1: 获取用户有效组织标签")
@@ -69,68 +175,446 @@ func (s *searchService) HybridSearch(ctx context.Context, query string, topK int
 	}
 	log.Infof("[SearchService] 步骤2: 向量化查询成功, 向量维度: %d", len(queryVector))
 
-	// 4. 构建 Elasticsearch 的复杂混合搜索查询 (与Java对齐)，并加入短语兜底 should
-	log.Info("[SearchService] 步骤3: 开始构建 Elasticsearch 两阶段混合搜索查询")
-	var buf bytes.Buffer
-	esQuery := map[string]interface{}{
-		"knn": map[string]interface{}{
-			"field":          "vector",
-			"query_vector":   queryVector,
-			"k":              topK * 30,
-			"num_candidates": topK * 30,
+	// 4. 按融合策略检索；启用重排序时多召回一些候选
+	useRerank := s.reranker != nil && !opts.DisableRerank
+	retrieveK := topK
+	if useRerank {
+		retrieveK = s.rerankCfg.Candidates(topK)
+	}
+	log.Infof("[SearchService] 步骤3: 开始检索, fusion: %s, kNN 权重: %.3f, BM25 权重: %.3f", rank.fusion, rank.weights.KNNWeight, rank.weights.BM25Weight)
+	req := retrievalRequest{
+		query:      query,
+		normalized: normalized,
+		phrase:     phrase,
+		vector:     queryVector,
+		filter:     searchFilter(permissionFilter(user.ID, userEffectiveTags), opts.Filters),
+		topK:       retrieveK,
+		highlight:  s.searchCfg.Highlight,
+	}
+	var hits []searchHit
+	if rank.fusion == config.FusionRescore {
+		hits, err = s.rescoreSearch(ctx, req, rank.weights)
+	} else {
+		hits, err = s.fusionSearch(ctx, req, rank)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 兜底校验：查询中的过滤条件出错时也不返回无权访问的分块
+	permitted := hits[:0]
+	for _, hit := range hits {
+		if !canAccess(hit.Source, user.ID, userEffectiveTags) {
+			log.Warnf("[SearchService] 丢弃无权访问的分块, FileMD5: %s, ChunkID: %d, user: %s", hit.Source.FileMD5, hit.Source.ChunkID, user.Username)
+			continue
+		}
+		permitted = append(permitted, hit)
+	}
+	hits = permitted
+
+	result := &SearchResult{Results: []model.SearchResponseDTO{}}
+	if opts.Facets {
+		if result.Facets, err = s.searchFacets(ctx, req, userEffectiveTags); err != nil {
+			return nil, err
+		}
+	}
+	if len(hits) == 0 {
+		log.Infof("[SearchService] Elasticsearch 返回 0 条命中结果")
+		if result.Facets != nil {
+			if err := s.labelFileFacets(result.Facets, nil, user.ID, userEffectiveTags); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	if useRerank {
+		hits = s.rerankHits(ctx, query, hits, topK)
+	}
+
+	// 5. 批量获取展示用的文件记录（包括分面中出现的文件）
+	log.Info("[SearchService] 步骤4: 开始批量获取文件信息")
+	uniqueMD5s := make(map[string]struct{})
+	for _, hit := range hits {
+		uniqueMD5s[hit.Source.FileMD5] = struct{}{}
+	}
+	if result.Facets != nil {
+		for _, bucket := range result.Facets.Files {
+			uniqueMD5s[bucket.Value] = struct{}{}
+		}
+	}
+	md5List := make([]string, 0, len(uniqueMD5s))
+	for md5 := range uniqueMD5s {
+		md5List = append(md5List, md5)
+	}
+
+	records, err := s.displayRecords(md5List, user.ID, userEffectiveTags)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[SearchService] 批量获取文件信息成功, 共获取 %d 个文件信息", len(records))
+	if result.Facets != nil {
+		if err := s.labelFileFacets(result.Facets, records, user.ID, userEffectiveTags); err != nil {
+			return nil, err
+		}
+	}
+
+	// 6. 组装最终结果
+	log.Info("[SearchService] 步骤5: 开始组装最终响应 DTO")
+	results := make([]model.SearchResponseDTO, 0, len(hits))
+	for _, hit := range hits {
+		dto := model.SearchResponseDTO{
+			FileMD5:        hit.Source.FileMD5,
+			FileName:       "未知文件",
+			ChunkID:        hit.Source.ChunkID,
+			TextContent:    hit.Source.TextContent,
+			Score:          hit.Score,
+			RetrievalScore: hit.Score,
+			RerankScore:    hit.RerankScore,
+			IsPublic:       hit.Source.IsPublic,
+			Highlights:     hit.Highlight["text_content"],
+		}
+		if record, ok := records[hit.Source.FileMD5]; ok {
+			dto.FileName = record.FileName
+			dto.UserID = strconv.FormatUint(uint64(record.UserID), 10)
+			dto.OrgTag = record.OrgTag
+		} else {
+			log.Warnf("[SearchService] 未找到 FileMD5 '%s' 对应的可访问文件记录, 将使用 '未知文件'", hit.Source.FileMD5)
+		}
+		if hit.RerankScore != nil {
+			dto.Score = *hit.RerankScore
+		}
+		results = append(results, dto)
+	}
+
+	log.Infof("[SearchService] 组装最终响应成功, 返回 %d 条结果", len(results))
+	log.Infof("[SearchService] 混合搜索执行完毕, query: '%s'", query)
+	result.Results = results
+	return result, nil
+}
+
+// displayRecords 为每个 file_md5 选出展示给用户的上传记录（文件名、上传者、组织标签）。
+// 同一文件可能由多个用户上传，只从已完成且用户有权访问的记录中选择，
+// 依次优先用户自己的、公开的、同组织的记录，同一优先级取最早的记录。
+func (s *searchService) displayRecords(md5s []string, userID uint, orgTags []string) (map[string]*model.FileUpload, error) {
+	records := make(map[string]*model.FileUpload, len(md5s))
+	if len(md5s) == 0 {
+		return records, nil
+	}
+	fileInfos, err := s.uploadRepo.FindBatchByMD5s(md5s)
+	if err != nil {
+		log.Errorf("[SearchService] 批量查询文件信息失败: %v", err)
+		return nil, fmt.Errorf("批量查询文件信息失败: %w", err)
+	}
+	for _, info := range fileInfos {
+		rank := displayRank(info, userID, orgTags)
+		if rank < 0 {
+			continue
+		}
+		current, ok := records[info.FileMD5]
+		if !ok {
+			records[info.FileMD5] = info
+			continue
+		}
+		if currentRank := displayRank(current, userID, orgTags); rank < currentRank || (rank == currentRank && info.ID < current.ID) {
+			records[info.FileMD5] = info
+		}
+	}
+	return records, nil
+}
+
+// displayRank 返回记录作为展示记录的优先级，数值越小越优先；记录未完成或用户无权访问时返回 -1。
+func displayRank(f *model.FileUpload, userID uint, orgTags []string) int {
+	if f.Status != 1 {
+		return -1
+	}
+	if f.UserID == userID {
+		return 0
+	}
+	if f.IsPublic {
+		return 1
+	}
+	for _, tag := range orgTags {
+		if f.OrgTag != "" && f.OrgTag == tag {
+			return 2
+		}
+	}
+	return -1
+}
+
+// labelFileFacets 为文件分面填充文件名。records 为 nil 时自行查询。
+func (s *searchService) labelFileFacets(facets *model.SearchFacets, records map[string]*model.FileUpload, userID uint, orgTags []string) error {
+	if records == nil {
+		md5s := make([]string, 0, len(facets.Files))
+		for _, bucket := range facets.Files {
+			md5s = append(md5s, bucket.Value)
+		}
+		var err error
+		if records, err = s.displayRecords(md5s, userID, orgTags); err != nil {
+			return err
+		}
+	}
+	for i := range facets.Files {
+		if record, ok := records[facets.Files[i].Value]; ok {
+			facets.Files[i].Label = record.FileName
+		}
+	}
+	return nil
+}
+
+// searchFacets 统计 kNN 召回窗口与 BM25 命中的并集中，分块按文件与组织标签的分布。
+// 它与检索使用相同的过滤条件，因此不受融合策略影响；组织标签只统计用户有权访问的标签。
+func (s *searchService) searchFacets(ctx context.Context, req retrievalRequest, orgTags []string) (*model.SearchFacets, error) {
+	aggs := map[string]interface{}{
+		"files": map[string]interface{}{
+			"terms": map[string]interface{}{"field": "file_md5", "size": facetSize},
 		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": map[string]interface{}{
-					"match": map[string]interface{}{
-						"text_content": normalized,
-					},
-				},
-				"filter": map[string]interface{}{
-					"bool": map[string]interface{}{
-						"should": []map[string]interface{}{
-							{"term": map[string]interface{}{"user_id": user.ID}},
-							{"term": map[string]interface{}{"is_public": true}},
-							{"terms": map[string]interface{}{"org_tag": userEffectiveTags}},
-						},
-						"minimum_should_match": 1,
-					},
+	}
+	if len(orgTags) > 0 {
+		aggs["org_tags"] = map[string]interface{}{
+			"terms": map[string]interface{}{"field": "org_tag", "size": facetSize, "include": orgTags},
+		}
+	}
+	body := map[string]interface{}{
+		"knn":   req.knnClause(),
+		"query": req.bm25Query(req.normalized),
+		"size":  0,
+		"aggs":  aggs,
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, fmt.Errorf("failed to encode es query: %w", err)
+	}
+	res, err := s.esClient.Search(
+		s.esClient.Search.WithContext(ctx),
+		s.esClient.Search.WithIndex(s.esCfg.IndexName),
+		s.esClient.Search.WithBody(&buf),
+	)
+	if err != nil {
+		log.Errorf("[SearchService] 向 Elasticsearch 发送分面统计请求失败: %v", err)
+		return nil, fmt.Errorf("elasticsearch facet search failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		log.Errorf("[SearchService] Elasticsearch 返回错误, status: %s, body: %s", res.Status(), string(bodyBytes))
+		return nil, fmt.Errorf("elasticsearch returned an error: %s", res.String())
+	}
+
+	type termsAgg struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int64  `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	var esResponse struct {
+		Aggregations struct {
+			Files   termsAgg `json:"files"`
+			OrgTags termsAgg `json:"org_tags"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&esResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode es response: %w", err)
+	}
+	toBuckets := func(agg termsAgg) []model.FacetBucket {
+		buckets := make([]model.FacetBucket, 0, len(agg.Buckets))
+		for _, b := range agg.Buckets {
+			buckets = append(buckets, model.FacetBucket{Value: b.Key, Count: b.DocCount})
+		}
+		return buckets
+	}
+	return &model.SearchFacets{
+		Files:   toBuckets(esResponse.Aggregations.Files),
+		OrgTags: toBuckets(esResponse.Aggregations.OrgTags),
+	}, nil
+}
+
+// rerankHits 用重排序模型对候选重新排序，返回前 topK 条并丢弃低于 min_score 的结果。
+// 重排序失败时记录日志并退回召回顺序，不影响检索可用性。
+func (s *searchService) rerankHits(ctx context.Context, query string, hits []searchHit, topK int) []searchHit {
+	documents := make([]string, len(hits))
+	for i, hit := range hits {
+		documents[i] = hit.Source.TextContent
+	}
+	results, err := s.reranker.Rerank(ctx, query, documents, topK)
+	if err != nil {
+		log.Warnf("[SearchService] 重排序失败，退回召回顺序: %v", err)
+		if len(hits) > topK {
+			hits = hits[:topK]
+		}
+		return hits
+	}
+
+	reranked := make([]searchHit, 0, len(results))
+	for _, r := range results {
+		if s.rerankCfg.MinScore > 0 && r.Score < s.rerankCfg.MinScore {
+			continue
+		}
+		hit := hits[r.Index]
+		score := r.Score
+		hit.RerankScore = &score
+		reranked = append(reranked, hit)
+	}
+	log.Infof("[SearchService] 重排序完成, model: %s, 候选: %d, 返回: %d", s.reranker.Model(), len(hits), len(reranked))
+	return reranked
+}
+
+// retrievalRequest 汇总一次检索在各融合策略间共用的输入。
+type retrievalRequest struct {
+	query      string
+	normalized string
+	phrase     string
+	vector     []float32
+	filter     map[string]interface{} // 权限与用户过滤条件
+	topK       int
+	highlight  config.HighlightConfig
+}
+
+// recallK 返回召回窗口大小。
+func (r retrievalRequest) recallK() int {
+	return r.topK * recallMultiplier
+}
+
+// bm25Query 构建 BM25 全文检索的 bool 查询：text 为 match 内容，附带过滤条件与核心短语兜底。
+func (r retrievalRequest) bm25Query(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must": map[string]interface{}{
+				"match": map[string]interface{}{
+					"text_content": text,
 				},
-				// 额外的 should：对核心短语做 match_phrase 以兜底召回
-				"should": buildPhraseShould(phrase),
 			},
+			"filter": r.filter,
+			// 额外的 should：对核心短语做 match_phrase 以兜底召回
+			"should": buildPhraseShould(r.phrase),
 		},
-		"rescore": map[string]interface{}{
-			"window_size": topK * 30, // 与 Java 的 recallK 对齐
-			"query": map[string]interface{}{
-				"rescore_query": map[string]interface{}{
-					"match": map[string]interface{}{
-						"text_content": map[string]interface{}{
-							"query":    normalized,
-							"operator": "and",
+	}
+}
+
+// highlightClause 构建 text_content 的高亮请求，只对 BM25 查询的匹配词生效。
+// 使用 html 编码器转义分块原文，前端可直接以 HTML 渲染片段。
+func (r retrievalRequest) highlightClause() map[string]interface{} {
+	preTag, postTag := r.highlight.Tags()
+	size, n := r.highlight.Fragments()
+	return map[string]interface{}{
+		"pre_tags":  []string{preTag},
+		"post_tags": []string{postTag},
+		"encoder":   "html",
+		"fields": map[string]interface{}{
+			"text_content": map[string]interface{}{
+				"fragment_size":       size,
+				"number_of_fragments": n,
+			},
+		},
+	}
+}
+
+// knnClause 构建带过滤条件的 kNN 子句，近邻检索阶段即排除无权访问或不符合过滤条件的分块。
+func (r retrievalRequest) knnClause() map[string]interface{} {
+	return map[string]interface{}{
+		"field":          "vector",
+		"query_vector":   r.vector,
+		"k":              r.recallK(),
+		"num_candidates": r.recallK(),
+		"filter":         r.filter,
+	}
+}
+
+// rescoreSearch 是默认的两阶段混合检索：kNN 与 BM25 联合召回后，以 operator=and 的 BM25 对召回窗口重打分。
+// 没有命中且核心短语与原问句不同时，用核心短语重试一次。
+func (s *searchService) rescoreSearch(ctx context.Context, req retrievalRequest, weights config.FusionWeightsConfig) ([]searchHit, error) {
+	build := func(text string) map[string]interface{} {
+		return map[string]interface{}{
+			"knn":   req.knnClause(),
+			"query": req.bm25Query(text),
+			"rescore": map[string]interface{}{
+				"window_size": req.recallK(),
+				"query": map[string]interface{}{
+					"rescore_query": map[string]interface{}{
+						"match": map[string]interface{}{
+							"text_content": map[string]interface{}{
+								"query":    text,
+								"operator": "and",
+							},
 						},
 					},
+					"query_weight":         weights.KNNWeight,  // 保留部分 k-NN 分数
+					"rescore_query_weight": weights.BM25Weight, // BM25 分数权重
 				},
-				"query_weight":         0.2, // 保留部分 k-NN 分数
-				"rescore_query_weight": 1.0, // BM25 分数权重
 			},
-		},
-		"size": topK,
+			"highlight": req.highlightClause(),
+			"size":      req.topK,
+			"_source":   sourceFilter(),
+		}
 	}
 
-	if err := json.NewEncoder(&buf).Encode(esQuery); err != nil {
+	hits, err := s.search(ctx, build(req.normalized))
+	if err != nil {
+		return nil, err
+	}
+	// 兜底：若规范化后核心短语存在且与原问句不同，则用核心短语重试一次（更强关键词信号）
+	if len(hits) == 0 && req.phrase != "" && req.phrase != req.query {
+		log.Infof("[SearchService] 使用核心短语重试查询: '%s'", req.phrase)
+		retryHits, err := s.search(ctx, build(req.phrase))
+		if err != nil {
+			log.Warnf("[SearchService] 核心短语重试查询失败: %v", err)
+			return hits, nil
+		}
+		log.Infof("[SearchService] 重试后命中 %d 条", len(retryHits))
+		hits = retryHits
+	}
+	return hits, nil
+}
+
+// fusionSearch 分别执行 kNN 与 BM25 检索（一次 _msearch 请求），再按 RRF 或线性加权融合两路结果。
+func (s *searchService) fusionSearch(ctx context.Context, req retrievalRequest, rank ranking) ([]searchHit, error) {
+	knnBody := map[string]interface{}{
+		"knn":     req.knnClause(),
+		"size":    req.recallK(),
+		"_source": sourceFilter(),
+	}
+	bm25Body := map[string]interface{}{
+		"query":     req.bm25Query(req.normalized),
+		"highlight": req.highlightClause(),
+		"size":      req.recallK(),
+		"_source":   sourceFilter(),
+	}
+	lists, err := s.multiSearch(ctx, knnBody, bm25Body)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[SearchService] 两路召回完成, kNN: %d 条, BM25: %d 条", len(lists[0]), len(lists[1]))
+
+	weights := []float64{rank.weights.KNNWeight, rank.weights.BM25Weight}
+	var fused []searchHit
+	if rank.fusion == config.FusionRRF {
+		fused = fuseRRF(lists, weights, rank.rrfK)
+	} else {
+		fused = fuseLinear(lists, weights)
+	}
+	if len(fused) > req.topK {
+		fused = fused[:req.topK]
+	}
+	return fused, nil
+}
+
+// sourceFilter 返回命中结果中需要的 _source 字段，向量不参与展示，排除以减小响应体。
+func sourceFilter() map[string]interface{} {
+	return map[string]interface{}{"excludes": []string{"vector"}}
+}
+
+// search 执行一次检索请求并返回命中列表。
+func (s *searchService) search(ctx context.Context, body map[string]interface{}) ([]searchHit, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
 		log.Errorf("[SearchService] 序列化 Elasticsearch 查询失败: %v", err)
 		return nil, fmt.Errorf("failed to encode es query: %w", err)
 	}
-	log.Infof("[SearchService] 已构建 Elasticsearch 查询语句")
-	//log.Infof("[SearchService] 构建的 Elasticsearch 查询语句: %s", buf.String())
 
-	// 5. 执行搜索
-	log.Info("[SearchService] 步骤4: 开始向 Elasticsearch 发送搜索请求")
-	// 与 Java 索引名保持一致（假设为 knowledge_base）
 	res, err := s.esClient.Search(
 		s.esClient.Search.WithContext(ctx),
-		s.esClient.Search.WithIndex("knowledge_base"),
+		s.esClient.Search.WithIndex(s.esCfg.IndexName),
 		s.esClient.Search.WithBody(&buf),
 		s.esClient.Search.WithTrackTotalHits(true),
 	)
@@ -145,120 +629,138 @@ func (s *searchService) HybridSearch(ctx context.Context, query string, topK int
 		log.Errorf("[SearchService] Elasticsearch 返回错误, status: %s, body: %s", res.Status(), string(bodyBytes))
 		return nil, fmt.Errorf("elasticsearch returned an error: %s", res.String())
 	}
-	log.Info("[SearchService] 成功从 Elasticsearch 获取响应")
 
-	// 6. 解析结果
-	log.Info("[SearchService] 步骤5: 开始解析 Elasticsearch 响应")
 	var esResponse struct {
 		Hits struct {
-			Hits []struct {
-				Source model.EsDocument `json:"_source"`
-				Score  float64          `json:"_score"` // 获取 ES 的 score
-			} `json:"hits"`
+			Hits []searchHit `json:"hits"`
 		} `json:"hits"`
 	}
-
 	if err := json.NewDecoder(res.Body).Decode(&esResponse); err != nil {
 		log.Errorf("[SearchService] 解析 Elasticsearch 响应失败: %v", err)
 		return nil, fmt.Errorf("failed to decode es response: %w", err)
 	}
+	return esResponse.Hits.Hits, nil
+}
 
-	if len(esResponse.Hits.Hits) == 0 {
-		log.Infof("[SearchService] Elasticsearch 返回 0 条命中结果")
-		// 兜底：若规范化后核心短语存在且与原问句不同，则用核心短语重试一次（更强关键词信号）
-		if phrase != "" && phrase != query {
-			log.Infof("[SearchService] 使用核心短语重试查询: '%s'", phrase)
-			// rebuild with phrase in must+rescore
-			var retryBuf bytes.Buffer
-			retryQuery := esQuery
-			// update must.match.text_content
-			((retryQuery["query"].(map[string]interface{}))["bool"].(map[string]interface{}))["must"] = map[string]interface{}{
-				"match": map[string]interface{}{
-					"text_content": phrase,
-				},
-			}
-			// update rescore query
-			((retryQuery["rescore"].(map[string]interface{}))["query"].(map[string]interface{}))["rescore_query"] = map[string]interface{}{
-				"match": map[string]interface{}{
-					"text_content": map[string]interface{}{
-						"query":    phrase,
-						"operator": "and",
-					},
-				},
-			}
-			if err := json.NewEncoder(&retryBuf).Encode(retryQuery); err == nil {
-				res2, err2 := s.esClient.Search(
-					s.esClient.Search.WithContext(ctx),
-					s.esClient.Search.WithIndex("knowledge_base"),
-					s.esClient.Search.WithBody(&retryBuf),
-					s.esClient.Search.WithTrackTotalHits(true),
-				)
-				if err2 == nil && !res2.IsError() {
-					defer res2.Body.Close()
-					if err := json.NewDecoder(res2.Body).Decode(&esResponse); err == nil {
-						log.Infof("[SearchService] 重试后命中 %d 条", len(esResponse.Hits.Hits))
-					}
-				}
-			}
+// multiSearch 通过一次 _msearch 请求执行多个检索，返回的命中列表与 bodies 一一对应。
+func (s *searchService) multiSearch(ctx context.Context, bodies ...map[string]interface{}) ([][]searchHit, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, body := range bodies {
+		if err := enc.Encode(map[string]interface{}{"index": s.esCfg.IndexName}); err != nil {
+			return nil, fmt.Errorf("failed to encode es msearch header: %w", err)
 		}
-		if len(esResponse.Hits.Hits) == 0 {
-			return []model.SearchResponseDTO{}, nil
+		if err := enc.Encode(body); err != nil {
+			log.Errorf("[SearchService] 序列化 Elasticsearch 查询失败: %v", err)
+			return nil, fmt.Errorf("failed to encode es query: %w", err)
 		}
 	}
 
-	// 7. 批量获取文件名
-	log.Info("[SearchService] 步骤6: 开始批量获取文件名")
-	fileMD5s := make([]string, 0, len(esResponse.Hits.Hits))
-	for _, hit := range esResponse.Hits.Hits {
-		fileMD5s = append(fileMD5s, hit.Source.FileMD5)
+	res, err := s.esClient.Msearch(&buf, s.esClient.Msearch.WithContext(ctx))
+	if err != nil {
+		log.Errorf("[SearchService] 向 Elasticsearch 发送 msearch 请求失败: %v", err)
+		return nil, fmt.Errorf("elasticsearch msearch failed: %w", err)
 	}
-	// 使用 map 去重
-	uniqueMD5s := make(map[string]struct{})
-	for _, md5 := range fileMD5s {
-		uniqueMD5s[md5] = struct{}{}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		log.Errorf("[SearchService] Elasticsearch 返回错误, status: %s, body: %s", res.Status(), string(bodyBytes))
+		return nil, fmt.Errorf("elasticsearch returned an error: %s", res.String())
 	}
-	md5List := make([]string, 0, len(uniqueMD5s))
-	for md5 := range uniqueMD5s {
-		md5List = append(md5List, md5)
+
+	var esResponse struct {
+		Responses []struct {
+			Hits struct {
+				Hits []searchHit `json:"hits"`
+			} `json:"hits"`
+			Error json.RawMessage `json:"error"`
+		} `json:"responses"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&esResponse); err != nil {
+		log.Errorf("[SearchService] 解析 Elasticsearch 响应失败: %v", err)
+		return nil, fmt.Errorf("failed to decode es response: %w", err)
+	}
+	if len(esResponse.Responses) != len(bodies) {
+		return nil, fmt.Errorf("elasticsearch msearch 返回 %d 个结果，期望 %d 个", len(esResponse.Responses), len(bodies))
+	}
+	lists := make([][]searchHit, len(bodies))
+	for i, r := range esResponse.Responses {
+		if len(r.Error) > 0 {
+			log.Errorf("[SearchService] msearch 第 %d 个查询失败: %s", i+1, string(r.Error))
+			return nil, fmt.Errorf("elasticsearch msearch query %d failed: %s", i+1, string(r.Error))
+		}
+		lists[i] = r.Hits.Hits
 	}
+	return lists, nil
+}
 
-	fileInfos, err := s.uploadRepo.FindBatchByMD5s(md5List)
-	if err != nil {
-		log.Errorf("[SearchService] 批量查询文件信息失败: %v", err)
-		return nil, fmt.Errorf("批量查询文件信息失败: %w", err)
+// permissionFilter 构建检索的权限过滤条件：用户自己上传的、公开的、或属于其有效组织标签的分块。
+// kNN 与 BM25 两路都必须使用同一过滤条件。
+func permissionFilter(userID uint, orgTags []string) map[string]interface{} {
+	if orgTags == nil {
+		orgTags = []string{}
 	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"term": map[string]interface{}{"user_id": userID}},
+				{"term": map[string]interface{}{"is_public": true}},
+				{"terms": map[string]interface{}{"org_tag": orgTags}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
 
-	fileNameMap := make(map[string]string)
-	for _, info := range fileInfos {
-		fileNameMap[info.FileMD5] = info.FileName
-	}
-	log.Infof("[SearchService] 批量获取文件名成功, 共获取 %d 个文件信息", len(fileNameMap))
-
-	// 8. 组装最终结果
-	log.Info("[SearchService] 步骤7: 开始组装最终响应 DTO")
-	var results []model.SearchResponseDTO
-	for _, hit := range esResponse.Hits.Hits {
-		fileName := fileNameMap[hit.Source.FileMD5]
-		if fileName == "" {
-			log.Warnf("[SearchService] 未找到 FileMD5 '%s' 对应的文件名, 将使用 '未知文件'", hit.Source.FileMD5)
-			fileName = "未知文件"
+// searchFilter 将权限过滤与用户指定的过滤条件合并为一个 bool 过滤，供 kNN 与 BM25 两路共用。
+func searchFilter(permission map[string]interface{}, f SearchFilters) map[string]interface{} {
+	clauses := []map[string]interface{}{permission}
+	if len(f.FileMD5s) > 0 {
+		clauses = append(clauses, map[string]interface{}{"terms": map[string]interface{}{"file_md5": f.FileMD5s}})
+	}
+	if len(f.OrgTags) > 0 {
+		clauses = append(clauses, map[string]interface{}{"terms": map[string]interface{}{"org_tag": f.OrgTags}})
+	}
+	if len(f.UserIDs) > 0 {
+		clauses = append(clauses, map[string]interface{}{"terms": map[string]interface{}{"user_id": f.UserIDs}})
+	}
+	if len(f.FileTypes) > 0 {
+		clauses = append(clauses, map[string]interface{}{"terms": map[string]interface{}{"file_type": f.FileTypes}})
+	}
+	if f.UploadedFrom != nil || f.UploadedTo != nil {
+		bounds := map[string]interface{}{}
+		if f.UploadedFrom != nil {
+			bounds["gte"] = f.UploadedFrom.Format(time.RFC3339Nano)
 		}
-		dto := model.SearchResponseDTO{
-			FileMD5:     hit.Source.FileMD5,
-			FileName:    fileName,
-			ChunkID:     hit.Source.ChunkID,
-			TextContent: hit.Source.TextContent,
-			Score:       hit.Score,
-			UserID:      strconv.FormatUint(uint64(hit.Source.UserID), 10),
-			OrgTag:      hit.Source.OrgTag,
-			IsPublic:    hit.Source.IsPublic,
+		if f.UploadedTo != nil {
+			bounds["lte"] = f.UploadedTo.Format(time.RFC3339Nano)
 		}
-		results = append(results, dto)
+		clauses = append(clauses, map[string]interface{}{"range": map[string]interface{}{"uploaded_at": bounds}})
 	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"filter": clauses},
+	}
+}
 
-	log.Infof("[SearchService] 组装最终响应成功, 返回 %d 条结果", len(results))
-	log.Infof("[SearchService] 混合搜索执行完毕, query: '%s'", query)
-	return results, nil
+// canAccess 按与 permissionFilter 相同的规则判断用户能否看到该分块。
+func canAccess(doc model.EsDocument, userID uint, orgTags []string) bool {
+	if doc.IsPublic {
+		return true
+	}
+	for _, id := range doc.UserID {
+		if id == userID {
+			return true
+		}
+	}
+	for _, tag := range doc.OrgTag {
+		for _, allowed := range orgTags {
+			if tag == allowed {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // normalizeQuery 对用户查询进行轻量去噪与短语提取。
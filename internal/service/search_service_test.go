@@ -0,0 +1,220 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"pai-smart-go/internal/model"
+)
+
+// assertJSON 比较 got 序列化后的 JSON 与 want 在语义上是否一致（忽略键顺序与空白）。
+func assertJSON(t *testing.T, got interface{}, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatalf("解析实际 JSON 失败: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("解析期望 JSON 失败: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("JSON 不一致\n实际: %s\n期望: %s", data, want)
+	}
+}
+
+func TestPermissionFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  uint
+		orgTags []string
+		want    string
+	}{
+		{
+			name:    "有组织标签",
+			userID:  7,
+			orgTags: []string{"dept-a", "PRIVATE_alice"},
+			want: `{"bool":{"minimum_should_match":1,"should":[
+				{"term":{"user_id":7}},
+				{"term":{"is_public":true}},
+				{"terms":{"org_tag":["dept-a","PRIVATE_alice"]}}]}}`,
+		},
+		{
+			// nil 必须序列化为 []，否则 terms 查询会因 null 报错
+			name:    "无组织标签",
+			userID:  3,
+			orgTags: nil,
+			want: `{"bool":{"minimum_should_match":1,"should":[
+				{"term":{"user_id":3}},
+				{"term":{"is_public":true}},
+				{"terms":{"org_tag":[]}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSON(t, permissionFilter(tt.userID, tt.orgTags), tt.want)
+		})
+	}
+}
+
+func TestRetrievalFilter(t *testing.T) {
+	filter := permissionFilter(7, []string{"dept-a"})
+	want := `{"bool":{"minimum_should_match":1,"should":[
+		{"term":{"user_id":7}},
+		{"term":{"is_public":true}},
+		{"terms":{"org_tag":["dept-a"]}}]}}`
+
+	// 权限过滤必须作为 kNN 的预过滤条件，否则 top-k 近邻会先被无权访问的分块占满
+	req := retrievalRequest{vector: []float32{0.1}, filter: filter, topK: 5}
+	assertJSON(t, req.knnClause()["filter"], want)
+	bm25 := req.bm25Query("问题")["bool"].(map[string]interface{})
+	assertJSON(t, bm25["filter"], want)
+}
+
+func TestSearchFilter(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 6, 30, 23, 59, 59, 0, time.UTC)
+	permission := `{"bool":{"minimum_should_match":1,"should":[
+		{"term":{"user_id":7}},
+		{"term":{"is_public":true}},
+		{"terms":{"org_tag":["dept-a"]}}]}}`
+
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		want    string
+	}{
+		{
+			name:    "仅权限过滤",
+			filters: SearchFilters{},
+			want:    `{"bool":{"filter":[` + permission + `]}}`,
+		},
+		{
+			name: "全部过滤条件",
+			filters: SearchFilters{
+				FileMD5s:     []string{"md5-1", "md5-2"},
+				OrgTags:      []string{"dept-a"},
+				UserIDs:      []uint{7, 9},
+				FileTypes:    []string{"pdf"},
+				UploadedFrom: &from,
+				UploadedTo:   &to,
+			},
+			want: `{"bool":{"filter":[` + permission + `,
+				{"terms":{"file_md5":["md5-1","md5-2"]}},
+				{"terms":{"org_tag":["dept-a"]}},
+				{"terms":{"user_id":[7,9]}},
+				{"terms":{"file_type":["pdf"]}},
+				{"range":{"uploaded_at":{"gte":"2024-01-01T00:00:00Z","lte":"2024-06-30T23:59:59Z"}}}]}}`,
+		},
+		{
+			name:    "只有上传时间下界",
+			filters: SearchFilters{UploadedFrom: &from},
+			want: `{"bool":{"filter":[` + permission + `,
+				{"range":{"uploaded_at":{"gte":"2024-01-01T00:00:00Z"}}}]}}`,
+		},
+		{
+			name:    "只有上传时间上界",
+			filters: SearchFilters{UploadedTo: &to},
+			want: `{"bool":{"filter":[` + permission + `,
+				{"range":{"uploaded_at":{"lte":"2024-06-30T23:59:59Z"}}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := searchFilter(permissionFilter(7, []string{"dept-a"}), tt.filters)
+			assertJSON(t, filter, tt.want)
+
+			// kNN 与 BM25 两路必须使用同一过滤条件，否则一路会召回无权访问或不符合条件的分块
+			req := retrievalRequest{vector: []float32{0.1}, filter: filter, topK: 5}
+			assertJSON(t, req.knnClause()["filter"], tt.want)
+			bm25 := req.bm25Query("问题")["bool"].(map[string]interface{})
+			assertJSON(t, bm25["filter"], tt.want)
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	const userID uint = 7
+	orgTags := []string{"dept-a", "PRIVATE_alice"}
+
+	tests := []struct {
+		name    string
+		doc     model.EsDocument
+		orgTags []string
+		want    bool
+	}{
+		{
+			name:    "所有者",
+			doc:     model.EsDocument{UserID: model.UintList{3, userID}, OrgTag: model.StringList{"dept-b"}},
+			orgTags: orgTags,
+			want:    true,
+		},
+		{
+			name:    "公开文件",
+			doc:     model.EsDocument{UserID: model.UintList{3}, OrgTag: model.StringList{"dept-b"}, IsPublic: true},
+			orgTags: orgTags,
+			want:    true,
+		},
+		{
+			name:    "同组织",
+			doc:     model.EsDocument{UserID: model.UintList{3}, OrgTag: model.StringList{"dept-b", "dept-a"}},
+			orgTags: orgTags,
+			want:    true,
+		},
+		{
+			name:    "其他组织",
+			doc:     model.EsDocument{UserID: model.UintList{3}, OrgTag: model.StringList{"dept-b"}},
+			orgTags: orgTags,
+			want:    false,
+		},
+		{
+			name:    "用户无组织标签",
+			doc:     model.EsDocument{UserID: model.UintList{3}, OrgTag: model.StringList{"dept-a"}},
+			orgTags: nil,
+			want:    false,
+		},
+		{
+			name:    "文档无组织标签",
+			doc:     model.EsDocument{UserID: model.UintList{3}},
+			orgTags: orgTags,
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canAccess(tt.doc, userID, tt.orgTags); got != tt.want {
+				t.Errorf("canAccess() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayRank(t *testing.T) {
+	const userID uint = 7
+	orgTags := []string{"dept-a"}
+
+	tests := []struct {
+		name string
+		file model.FileUpload
+		want int
+	}{
+		{name: "自己的记录", file: model.FileUpload{Status: 1, UserID: userID, OrgTag: "dept-b"}, want: 0},
+		{name: "公开记录", file: model.FileUpload{Status: 1, UserID: 3, OrgTag: "dept-b", IsPublic: true}, want: 1},
+		{name: "同组织记录", file: model.FileUpload{Status: 1, UserID: 3, OrgTag: "dept-a"}, want: 2},
+		{name: "其他组织的私有记录", file: model.FileUpload{Status: 1, UserID: 3, OrgTag: "dept-b"}, want: -1},
+		{name: "无组织标签", file: model.FileUpload{Status: 1, UserID: 3}, want: -1},
+		{name: "未完成的上传", file: model.FileUpload{Status: 0, UserID: userID, IsPublic: true}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := displayRank(&tt.file, userID, orgTags); got != tt.want {
+				t.Errorf("displayRank() = %d, 期望 %d", got, tt.want)
+			}
+		})
+	}
+}
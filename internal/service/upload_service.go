@@ -3,18 +3,26 @@ package service
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
 	"mime/multipart"
 	"pai-smart-go/internal/config"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/internal/repository"
+	"pai-smart-go/pkg/es"
 	"pai-smart-go/pkg/kafka"
 	"pai-smart-go/pkg/log"
 	"pai-smart-go/pkg/storage"
 	"pai-smart-go/pkg/tasks"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
@@ -25,62 +33,146 @@ const (
 	DefaultChunkSize = 5 * 1024 * 1024
 )
 
+var (
+	// ErrChunkChecksumMismatch 表示分片内容与客户端提供的分片 MD5 不一致。
+	ErrChunkChecksumMismatch = errors.New("分片校验失败")
+	// ErrFileChecksumMismatch 表示合并后的文件与声明的文件 MD5 或大小不一致，上传已被丢弃。
+	ErrFileChecksumMismatch = errors.New("文件校验失败")
+	// ErrPossessionProofInvalid 表示持有证明与挑战不符，或挑战不存在、已过期。
+	ErrPossessionProofInvalid = errors.New("文件持有证明无效")
+)
+
+const (
+	// possessionChallengeTTL 是持有证明挑战的有效期。
+	possessionChallengeTTL = 5 * time.Minute
+	// possessionChallengeLength 是持有证明挑战的字节范围长度上限。
+	possessionChallengeLength = 64 * 1024
+)
+
+// InstantUploadOptions 是跨用户秒传时为当前用户新建文件记录所用的元数据。
+// FileName 留空时沿用已有文件的名称，OrgTag 留空时使用用户的主组织。
+// Proof 是对上一次返回的持有证明挑战的应答，复用当前用户无权读取的文件时必须提供。
+type InstantUploadOptions struct {
+	FileName string
+	OrgTag   string
+	IsPublic bool
+	Proof    string
+}
+
+// InstantUploadResult 是秒传检查的结果。
+// 存在相同内容、但当前用户无权读取的文件时返回 Challenge，客户端可提交持有证明后重新请求，或继续普通上传。
+type InstantUploadResult struct {
+	Completed      bool
+	UploadedChunks []int
+	Challenge      *model.PossessionChallenge
+}
+
 // UploadService 接口定义了文件上传相关的业务操作。
 type UploadService interface {
-	CheckFile(ctx context.Context, fileMD5 string, userID uint) (bool, []int, error)
-	UploadChunk(ctx context.Context, fileMD5, fileName string, totalSize int64, chunkIndex int, file multipart.File, userID uint, orgTag string, isPublic bool) (uploadedChunks []int, totalChunks int, err error)
+	CheckFile(ctx context.Context, fileMD5 string, userID uint, opts InstantUploadOptions) (*InstantUploadResult, error)
+	UploadChunk(ctx context.Context, fileMD5, fileName string, totalSize int64, chunkIndex int, chunkMD5 string, file multipart.File, userID uint, orgTag string, isPublic bool) (uploadedChunks []int, totalChunks int, err error)
 	MergeChunks(ctx context.Context, fileMD5, fileName string, userID uint) (string, error)
 	GetUploadStatus(ctx context.Context, fileMD5 string, userID uint) (fileName string, fileType string, uploadedChunks []int, totalChunks int, err error)
 	GetSupportedFileTypes() (map[string]interface{}, error)
-	FastUpload(ctx context.Context, fileMD5 string, userID uint) (bool, error)
+	FastUpload(ctx context.Context, fileMD5 string, userID uint, opts InstantUploadOptions) (*InstantUploadResult, error)
+	GetStaleUploadReport(ctx context.Context) (*StaleUploadReport, error)
+	CleanupStaleUploads(ctx context.Context) (int, error)
+}
+
+// StaleUpload 描述一个已过期、将被清理的未完成上传。
+type StaleUpload struct {
+	FileMD5        string    `json:"fileMd5"`
+	FileName       string    `json:"fileName"`
+	UserID         uint      `json:"userId"`
+	TotalSize      int64     `json:"totalSize"`
+	UploadedChunks int       `json:"uploadedChunks"`
+	TotalChunks    int       `json:"totalChunks"`
+	LastActivityAt time.Time `json:"lastActivityAt"`
 }
 
+// StaleUploadReport 是过期上传的试运行报告，列出下一次清理将删除的上传，不做任何修改。
+type StaleUploadReport struct {
+	TTLHours float64       `json:"ttlHours"`
+	Cutoff   time.Time     `json:"cutoff"`
+	Count    int           `json:"count"`
+	Uploads  []StaleUpload `json:"uploads"`
+}
+
+// staleUploadBatchSize 是每轮清理处理的过期上传数上限，剩余的留给下一轮。
+const staleUploadBatchSize = 500
+
 type uploadService struct {
-	uploadRepo repository.UploadRepository
-	userRepo   repository.UserRepository // We need user repo to get user info
-	minioCfg   config.MinIOConfig
+	uploadRepo  repository.UploadRepository
+	userRepo    repository.UserRepository // We need user repo to get user info
+	userService UserService               // 用于计算秒传时用户的有效组织标签
+	minioCfg    config.MinIOConfig
+	esCfg       config.ElasticsearchConfig
+	uploadCfg   config.UploadConfig
 }
 
 // NewUploadService 创建一个新的 UploadService 实例。
-func NewUploadService(uploadRepo repository.UploadRepository, userRepo repository.UserRepository, minioCfg config.MinIOConfig) UploadService {
+func NewUploadService(uploadRepo repository.UploadRepository, userRepo repository.UserRepository, userService UserService, minioCfg config.MinIOConfig, esCfg config.ElasticsearchConfig, uploadCfg config.UploadConfig) UploadService {
 	return &uploadService{
-		uploadRepo: uploadRepo,
-		userRepo:   userRepo,
-		minioCfg:   minioCfg,
+		uploadRepo:  uploadRepo,
+		userRepo:    userRepo,
+		userService: userService,
+		minioCfg:    minioCfg,
+		esCfg:       esCfg,
+		uploadCfg:   uploadCfg,
 	}
 }
 
 // CheckFile 检查文件是否已上传（秒传逻辑）。
-func (s *uploadService) CheckFile(ctx context.Context, fileMD5 string, userID uint) (bool, []int, error) {
+// 当前用户没有已完成的记录、但其他用户已上传过相同内容时，在用户有权读取该文件或通过持有证明后，
+// 直接为当前用户建立指向同一对象的记录。
+func (s *uploadService) CheckFile(ctx context.Context, fileMD5 string, userID uint, opts InstantUploadOptions) (*InstantUploadResult, error) {
 	log.Infof("[CheckFile] 开始秒传检查，文件MD5: %s, 用户ID: %d", fileMD5, userID)
 
 	record, err := s.uploadRepo.GetFileUploadRecord(fileMD5, userID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			linked, challenge, linkErr := s.linkSharedFile(ctx, fileMD5, userID, nil, opts, true)
+			if linkErr != nil {
+				log.Errorf("[CheckFile] 秒传检查失败：复用其他用户的文件时出错, error: %v", linkErr)
+				return nil, linkErr
+			}
+			if linked {
+				return &InstantUploadResult{Completed: true}, nil
+			}
 			log.Infof("[CheckFile] 文件记录不存在，需要进行普通上传。文件MD5: %s", fileMD5)
-			return false, nil, nil
+			return &InstantUploadResult{Challenge: challenge}, nil
 		}
 		log.Errorf("[CheckFile] 秒传检查失败：查询文件记录时出错, error: %v", err)
-		return false, nil, err
+		return nil, err
 	}
 
 	if record.Status == 1 {
 		log.Infof("[CheckFile] 文件已存在且状态为已完成，秒传成功。文件MD5: %s", fileMD5)
-		return true, nil, nil
+		return &InstantUploadResult{Completed: true}, nil
+	}
+
+	// 上传未完成时若已有其他用户的完整文件，直接复用，无需继续上传剩余分片
+	linked, challenge, err := s.linkSharedFile(ctx, fileMD5, userID, record, opts, true)
+	if err != nil {
+		log.Errorf("[CheckFile] 秒传检查失败：复用其他用户的文件时出错, error: %v", err)
+		return nil, err
+	}
+	if linked {
+		return &InstantUploadResult{Completed: true}, nil
 	}
 
 	totalChunks := s.calculateTotalChunks(record.TotalSize)
 	uploadedIndexes, err := s.uploadRepo.GetUploadedChunksFromRedis(ctx, fileMD5, userID, totalChunks)
 	if err != nil {
 		log.Errorf("[CheckFile] 秒传检查失败：从Redis获取已上传分片列表时出错, error: %v", err)
-		return false, nil, err
+		return nil, err
 	}
 	log.Infof("[CheckFile] 文件记录已存在但未完成，返回已上传的分片列表。文件MD5: %s, 已上传分片数: %d", fileMD5, len(uploadedIndexes))
-	return false, uploadedIndexes, nil
+	return &InstantUploadResult{UploadedChunks: uploadedIndexes, Challenge: challenge}, nil
 }
 
-// UploadChunk 处理单个分片的上传。
-func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName string, totalSize int64, chunkIndex int, file multipart.File, userID uint, orgTag string, isPublic bool) ([]int, int, error) {
+// UploadChunk 处理单个分片的上传。chunkMD5 可选，提供时分片内容必须与之一致。
+func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName string, totalSize int64, chunkIndex int, chunkMD5 string, file multipart.File, userID uint, orgTag string, isPublic bool) ([]int, int, error) {
 	log.Infof("[UploadChunk] 开始上传分片，文件MD5: %s, 分片序号: %d, 用户ID: %d", fileMD5, chunkIndex, userID)
 
 	// 增强逻辑: 文件类型验证 (简化版)
@@ -134,6 +226,11 @@ func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName strin
 		return nil, 0, err
 	}
 
+	// 每次分片请求都刷新活动时间，仍在进行的上传不会被过期清理
+	if err := s.uploadRepo.TouchChunkUpload(record.ID); err != nil {
+		log.Warnf("[UploadChunk] 更新最后上传分片时间失败, error: %v", err)
+	}
+
 	// 2. 检查分片是否已上传 (Redis)
 	isUploaded, err := s.uploadRepo.IsChunkUploaded(ctx, fileMD5, userID, chunkIndex)
 	if err != nil {
@@ -150,19 +247,30 @@ func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName strin
 		return uploadedIndexes, totalChunks, nil
 	}
 
-	// 3. 将分片上传到 MinIO
+	// 3. 计算分片 MD5，客户端提供了期望值时先校验，避免损坏的分片进入合并
+	actualChunkMD5, chunkSize, err := hashChunk(file)
+	if err != nil {
+		log.Errorf("[UploadChunk] 计算分片MD5失败, error: %v", err)
+		return nil, 0, err
+	}
+	if chunkMD5 != "" && !strings.EqualFold(chunkMD5, actualChunkMD5) {
+		log.Warnf("[UploadChunk] 分片校验失败。文件MD5: %s, 分片序号: %d, 期望: %s, 实际: %s", fileMD5, chunkIndex, chunkMD5, actualChunkMD5)
+		return nil, 0, fmt.Errorf("%w: 分片 %d 的 MD5 为 %s，与提供的 %s 不一致", ErrChunkChecksumMismatch, chunkIndex, actualChunkMD5, chunkMD5)
+	}
+
+	// 4. 将分片上传到 MinIO
 	objectName := fmt.Sprintf("chunks/%s/%d", fileMD5, chunkIndex) // 与 Java 一致的路径
-	_, err = storage.MinioClient.PutObject(ctx, s.minioCfg.BucketName, objectName, file, -1, minio.PutObjectOptions{})
+	_, err = storage.MinioClient.PutObject(ctx, s.minioCfg.BucketName, objectName, file, chunkSize, minio.PutObjectOptions{})
 	if err != nil {
 		log.Errorf("[UploadChunk] 上传分片到MinIO失败, objectName: %s, error: %v", objectName, err)
 		return nil, 0, err
 	}
 
-	// 4. 在数据库中记录分片信息
+	// 5. 在数据库中记录分片信息
 	chunkRecord := &model.ChunkInfo{
 		FileMD5:     fileMD5,
 		ChunkIndex:  chunkIndex,
-		ChunkMD5:    "",         // Go version doesn't calculate chunk md5 for now
+		ChunkMD5:    actualChunkMD5,
 		StoragePath: objectName, // 保存存储路径
 	}
 	if err := s.uploadRepo.CreateChunkInfoRecord(chunkRecord); err != nil {
@@ -170,13 +278,13 @@ func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName strin
 		return nil, 0, err
 	}
 
-	// 5. 在 Redis 中标记分片为已上传
+	// 6. 在 Redis 中标记分片为已上传
 	if err := s.uploadRepo.MarkChunkUploaded(ctx, fileMD5, userID, chunkIndex); err != nil {
 		log.Errorf("[UploadChunk] 严重错误：在Redis中标记分片已上传失败, error: %v", err)
 		return nil, 0, err
 	}
 
-	// 6. 获取最新的已上传分片列表并计算总分片数
+	// 7. 获取最新的已上传分片列表并计算总分片数
 	totalChunks := s.calculateTotalChunks(record.TotalSize)
 	uploadedIndexes, err := s.uploadRepo.GetUploadedChunksFromRedis(ctx, fileMD5, userID, totalChunks)
 	if err != nil {
@@ -188,7 +296,7 @@ func (s *uploadService) UploadChunk(ctx context.Context, fileMD5, fileName strin
 	return uploadedIndexes, totalChunks, nil
 }
 
-// MergeChunks 合并所有分片。
+// MergeChunks 合并所有分片，并校验合并结果与声明的文件 MD5 一致。
 func (s *uploadService) MergeChunks(ctx context.Context, fileMD5, fileName string, userID uint) (string, error) {
 	log.Infof("[MergeChunks] 开始合并文件分片，文件MD5: %s, 用户ID: %d", fileMD5, userID)
 	record, err := s.uploadRepo.GetFileUploadRecord(fileMD5, userID)
@@ -209,8 +317,20 @@ func (s *uploadService) MergeChunks(ctx context.Context, fileMD5, fileName strin
 		return "", fmt.Errorf("分片未全部上传，无法合并 (期望: %d, 实际: %d)", totalChunks, len(uploadedIndexes))
 	}
 
-	// 2. 根据分片数量选择合并策略
-	destObjectName := fmt.Sprintf("merged/%s", fileName) // 与 Java 一致的路径
+	// 2. 上传期间其他用户可能已完成了相同文件的上传，用户有权读取时直接复用其对象；
+	// 无权读取时照常合并，合并结果的 MD5 校验即是持有证明，不再发放挑战
+	linked, _, err := s.linkSharedFile(ctx, fileMD5, userID, record, InstantUploadOptions{}, false)
+	if err != nil {
+		log.Errorf("[MergeChunks] 合并分片失败：复用其他用户的文件时出错, error: %v", err)
+		return "", err
+	}
+	if linked {
+		go s.removeChunks(fileMD5, userID, totalChunks)
+		return storage.GetPresignedURL(s.minioCfg.BucketName, record.ObjectKey, time.Hour)
+	}
+
+	// 3. 根据分片数量选择合并策略
+	destObjectName := model.MergedObjectKey(userID, fileMD5)
 
 	if totalChunks == 1 {
 		// 对于单分片文件，使用 CopyObject
@@ -251,53 +371,393 @@ func (s *uploadService) MergeChunks(ctx context.Context, fileMD5, fileName strin
 		log.Infof("[MergeChunks] 多分片文件合并成功。")
 	}
 
-	// 3. 更新数据库记录状态
-	if err := s.uploadRepo.UpdateFileUploadStatus(record.ID, 1); err != nil {
+	// 4. 校验合并结果的大小与 MD5，不一致时丢弃本次上传，防止错误内容污染秒传与去重
+	if err := s.verifyMergedObject(ctx, record, destObjectName); err != nil {
+		if errors.Is(err, ErrFileChecksumMismatch) {
+			s.discardUpload(record, destObjectName, totalChunks)
+		}
+		return "", err
+	}
+
+	// 5. 更新数据库记录状态
+	if err := s.uploadRepo.MarkMerged(record.ID, destObjectName); err != nil {
 		log.Errorf("[MergeChunks] 更新数据库文件状态为“已完成”失败, error: %v", err)
 		return "", err
 	}
 	log.Infof("[MergeChunks] 数据库文件状态已更新为“已完成”。文件ID: %d", record.ID)
 
-	// 4. 触发 Kafka 消息
+	// 6. 触发 Kafka 消息
 	objectURL, _ := storage.GetPresignedURL(s.minioCfg.BucketName, destObjectName, 60*60)
 	task := tasks.FileProcessingTask{
 		FileMD5:   fileMD5,
 		ObjectUrl: objectURL,
+		ObjectKey: destObjectName,
 		FileName:  fileName,
 		UserID:    userID,
 		OrgTag:    record.OrgTag,
 		IsPublic:  record.IsPublic,
 	}
+	// 先置为排队中再发送，避免覆盖消费者已写入的后续状态
+	if err := s.uploadRepo.UpdateProcessingState(fileMD5, userID, model.ProcessingState{Status: model.ProcessingStatusQueued}); err != nil {
+		log.Warnf("[MergeChunks] 更新文件处理状态为排队中失败, error: %v", err)
+	}
 	if err := kafka.ProduceFileTask(task); err != nil {
 		log.Errorf("[MergeChunks] 发送文件处理任务到Kafka失败, error: %v", err)
+		failed := model.ProcessingState{Status: model.ProcessingStatusFailed, Error: fmt.Sprintf("发送文件处理任务失败: %v", err)}
+		if err := s.uploadRepo.UpdateProcessingState(fileMD5, userID, failed); err != nil {
+			log.Warnf("[MergeChunks] 记录文件处理失败状态时出错, error: %v", err)
+		}
 	} else {
 		log.Infof("[MergeChunks] 文件处理任务已成功发送到Kafka。")
 	}
 
-	// 5. 清理 Redis 和 MinIO 中的分片
-	go func() {
-		bgCtx := context.Background()
-		log.Infof("[MergeChunks] 启动后台清理任务。文件MD5: %s", fileMD5)
-		if err := s.uploadRepo.DeleteUploadMark(bgCtx, fileMD5, userID); err != nil {
-			log.Warnf("[MergeChunks] 后台清理任务：删除Redis上传标记失败, fileMD5: %s, error: %v", fileMD5, err)
+	// 7. 清理 Redis 和 MinIO 中的分片
+	go s.removeChunks(fileMD5, userID, totalChunks)
+
+	return objectURL, nil
+}
+
+// linkSharedFile 在其他用户已完整上传过相同内容时，为当前用户建立指向同一对象的已完成记录，
+// 复用已生成的分块与向量，并将当前用户加入检索文档的所有者。record 为当前用户未完成的记录，没有时传 nil。
+// 只有用户已能读取的文件（公开的或属于其有效组织标签的）可直接复用；否则需提交 opts.Proof 通过持有证明，
+// issueChallenge 为 true 时为此返回一个新的挑战。返回 false 表示没有复用。
+// 合并对象按引用它的记录数计数，最后一个所有者删除时才会删除。
+func (s *uploadService) linkSharedFile(ctx context.Context, fileMD5 string, userID uint, record *model.FileUpload, opts InstantUploadOptions, issueChallenge bool) (bool, *model.PossessionChallenge, error) {
+	candidates, err := s.uploadRepo.FindShareableFiles(fileMD5, userID)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(candidates) == 0 {
+		return false, nil, nil
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return false, nil, err
+	}
+	source, err := s.readableSource(user, candidates)
+	if err != nil {
+		return false, nil, err
+	}
+	if source == nil && opts.Proof != "" {
+		if err := s.verifyPossession(ctx, fileMD5, userID, &candidates[0], opts.Proof); err != nil {
+			return false, nil, err
+		}
+		source = &candidates[0]
+	}
+	if source == nil {
+		if !issueChallenge {
+			return false, nil, nil
+		}
+		challenge, err := s.issuePossessionChallenge(ctx, fileMD5, userID, candidates[0].TotalSize)
+		if err != nil {
+			return false, nil, err
+		}
+		log.Infof("[Upload] 存在相同内容的文件但用户无权读取，已发放持有证明挑战。文件MD5: %s, 用户ID: %d", fileMD5, userID)
+		return false, challenge, nil
+	}
+	if _, err := storage.MinioClient.StatObject(ctx, s.minioCfg.BucketName, source.ObjectKey, minio.StatObjectOptions{}); err != nil {
+		log.Warnf("[Upload] 可复用文件的对象不可用，改为普通上传。object: %s, error: %v", source.ObjectKey, err)
+		return false, nil, nil
+	}
+
+	if record == nil {
+		orgTag := opts.OrgTag
+		if orgTag == "" {
+			orgTag = user.PrimaryOrg
+		}
+		fileName := opts.FileName
+		if fileName == "" {
+			fileName = source.FileName
+		}
+		record = &model.FileUpload{
+			FileMD5:  fileMD5,
+			FileName: fileName,
+			UserID:   userID,
+			OrgTag:   orgTag,
+			IsPublic: opts.IsPublic,
+		}
+	}
+	now := time.Now()
+	record.Status = 1
+	record.TotalSize = source.TotalSize
+	record.ObjectKey = source.ObjectKey
+	record.MergedAt = &now
+	// 分块与向量按 file_md5 共享，处理进度与被复用的文件一致，后续由 Processor 同步更新
+	record.ProcessingStatus = source.ProcessingStatus
+	record.ChunkCount = source.ChunkCount
+	record.IndexedCount = source.IndexedCount
+	record.ProcessingError = source.ProcessingError
+	record.ProcessingUpdatedAt = source.ProcessingUpdatedAt
+	if record.ID == 0 {
+		err = s.uploadRepo.CreateFileUploadRecord(record)
+	} else {
+		err = s.uploadRepo.UpdateFileUploadRecord(record)
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if err := s.uploadRepo.DeleteUploadMark(ctx, fileMD5, userID); err != nil {
+		log.Warnf("[Upload] 删除Redis上传标记失败, fileMD5: %s, error: %v", fileMD5, err)
+	}
+	log.Infof("[Upload] 跨用户秒传成功，复用用户 %d 的文件。文件MD5: %s, 用户ID: %d, object: %s", source.UserID, fileMD5, userID, source.ObjectKey)
+
+	// 文件尚在处理中时分块可能还未写入，Processor 写入时会读取最新的所有者
+	if err := s.syncOwners(ctx, fileMD5); err != nil {
+		log.Errorf("[Upload] 同步检索文档所有者失败, fileMD5: %s, error: %v", fileMD5, err)
+		failed := model.ProcessingState{Status: model.ProcessingStatusFailed, Error: fmt.Sprintf("同步检索权限失败，请重新处理: %v", err)}
+		if err := s.uploadRepo.UpdateProcessingState(fileMD5, userID, failed); err != nil {
+			log.Warnf("[Upload] 记录文件处理失败状态时出错, error: %v", err)
+		}
+	}
+	return true, nil, nil
+}
+
+// readableSource 返回候选文件中用户已有权读取的一个：公开的，或组织标签属于用户有效组织标签的。没有时返回 nil。
+func (s *uploadService) readableSource(user *model.User, candidates []model.FileUpload) (*model.FileUpload, error) {
+	orgTags, err := s.userService.GetUserEffectiveOrgTags(user)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]struct{}, len(orgTags))
+	for _, tag := range orgTags {
+		allowed[tag] = struct{}{}
+	}
+	for i := range candidates {
+		if candidates[i].IsPublic {
+			return &candidates[i], nil
 		}
+		if _, ok := allowed[candidates[i].OrgTag]; ok && candidates[i].OrgTag != "" {
+			return &candidates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// issuePossessionChallenge 在文件内随机选取一个字节范围作为持有证明挑战并保存。
+func (s *uploadService) issuePossessionChallenge(ctx context.Context, fileMD5 string, userID uint, totalSize int64) (*model.PossessionChallenge, error) {
+	length := int64(possessionChallengeLength)
+	if totalSize < length {
+		length = totalSize
+	}
+	var offset int64
+	if span := totalSize - length; span > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(span+1))
+		if err != nil {
+			return nil, err
+		}
+		offset = n.Int64()
+	}
+	challenge := &model.PossessionChallenge{
+		Offset:    offset,
+		Length:    length,
+		ExpiresAt: time.Now().Add(possessionChallengeTTL),
+	}
+	if err := s.uploadRepo.SavePossessionChallenge(ctx, fileMD5, userID, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// verifyPossession 校验持有证明：proof 必须等于 source 对象中挑战字节范围的 SHA-256。挑战校验一次即失效。
+func (s *uploadService) verifyPossession(ctx context.Context, fileMD5 string, userID uint, source *model.FileUpload, proof string) error {
+	challenge, err := s.uploadRepo.TakePossessionChallenge(ctx, fileMD5, userID)
+	if err != nil {
+		return err
+	}
+	if challenge == nil {
+		return fmt.Errorf("%w: 挑战不存在或已过期，请重新请求", ErrPossessionProofInvalid)
+	}
+	expected, err := storage.ObjectRangeSHA256(ctx, s.minioCfg.BucketName, source.ObjectKey, challenge.Offset, challenge.Length)
+	if err != nil {
+		return fmt.Errorf("读取文件以校验持有证明失败: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.ToLower(proof)), []byte(expected)) != 1 {
+		log.Warnf("[Upload] 持有证明校验失败。文件MD5: %s, 用户ID: %d", fileMD5, userID)
+		return ErrPossessionProofInvalid
+	}
+	return nil
+}
+
+// syncOwners 将检索文档的所有者更新为共享该文件内容的全部已完成记录。
+func (s *uploadService) syncOwners(ctx context.Context, fileMD5 string) error {
+	files, err := s.uploadRepo.FindBatchByMD5s([]string{fileMD5})
+	if err != nil {
+		return err
+	}
+	owners, ok := model.GroupOwners(files)[fileMD5]
+	if !ok {
+		return nil
+	}
+	_, err = es.UpdateOwners(ctx, s.esCfg.IndexName, fileMD5, owners)
+	return err
+}
+
+// verifyMergedObject 校验合并后对象的大小与 MD5 是否与上传记录一致。
+func (s *uploadService) verifyMergedObject(ctx context.Context, record *model.FileUpload, objectName string) error {
+	actualMD5, size, err := storage.ObjectMD5(ctx, s.minioCfg.BucketName, objectName)
+	if err != nil {
+		log.Errorf("[MergeChunks] 读取合并后的文件以校验MD5失败, error: %v", err)
+		return fmt.Errorf("failed to verify merged object: %w", err)
+	}
+	if size != record.TotalSize {
+		log.Warnf("[MergeChunks] 合并后的文件大小不一致。文件MD5: %s, 期望: %d, 实际: %d", record.FileMD5, record.TotalSize, size)
+		return fmt.Errorf("%w: 合并后的文件大小为 %d 字节，与声明的 %d 字节不一致，请重新上传", ErrFileChecksumMismatch, size, record.TotalSize)
+	}
+	if !strings.EqualFold(actualMD5, record.FileMD5) {
+		log.Warnf("[MergeChunks] 合并后的文件MD5不一致。期望: %s, 实际: %s", record.FileMD5, actualMD5)
+		return fmt.Errorf("%w: 合并后的文件 MD5 为 %s，与声明的 %s 不一致，请重新上传", ErrFileChecksumMismatch, actualMD5, record.FileMD5)
+	}
+	log.Infof("[MergeChunks] 合并后的文件校验通过。文件MD5: %s, 大小: %d", record.FileMD5, size)
+	return nil
+}
+
+// discardUpload 在合并结果校验失败后删除合并对象，并将记录标记为失败，客户端需重新上传。
+// 分片对象与分片记录按 file_md5 共享，只在没有其他用户仍在上传同一文件时删除。
+func (s *uploadService) discardUpload(record *model.FileUpload, objectName string, totalChunks int) {
+	ctx := context.Background()
+	if err := storage.MinioClient.RemoveObject(ctx, s.minioCfg.BucketName, objectName, minio.RemoveObjectOptions{}); err != nil {
+		log.Warnf("[MergeChunks] 删除校验失败的合并文件失败, object: %s, error: %v", objectName, err)
+	}
+	if err := s.uploadRepo.UpdateFileUploadStatus(record.ID, 2); err != nil {
+		log.Warnf("[MergeChunks] 更新文件状态为“失败”失败, error: %v", err)
+	}
+	if !s.removeChunks(record.FileMD5, record.UserID, totalChunks) {
+		return
+	}
+	if err := s.uploadRepo.DeleteChunkInfoRecords(record.FileMD5); err != nil {
+		log.Warnf("[MergeChunks] 删除分片记录失败, fileMD5: %s, error: %v", record.FileMD5, err)
+	}
+}
+
+// removeChunks 删除当前用户在 Redis 中的上传标记，没有其他用户仍在上传同一文件时再删除 MinIO 中的分片对象。
+// 返回分片对象是否已删除。
+func (s *uploadService) removeChunks(fileMD5 string, userID uint, totalChunks int) bool {
+	bgCtx := context.Background()
+	log.Infof("[MergeChunks] 启动清理任务。文件MD5: %s", fileMD5)
+	if err := s.uploadRepo.DeleteUploadMark(bgCtx, fileMD5, userID); err != nil {
+		log.Warnf("[MergeChunks] 清理任务：删除Redis上传标记失败, fileMD5: %s, error: %v", fileMD5, err)
+	}
+
+	if s.chunksInUse(fileMD5) {
+		log.Infof("[MergeChunks] 其他用户仍在上传同一文件，保留分片。文件MD5: %s", fileMD5)
+		return false
+	}
+	s.removeChunkObjects(bgCtx, fileMD5, totalChunks)
+	log.Infof("[MergeChunks] 清理任务完成。文件MD5: %s", fileMD5)
+	return true
+}
+
+// chunksInUse 判断是否还有未完成的上传在使用该文件的分片；统计失败时按仍在使用处理，宁可保留分片交给过期清理。
+func (s *uploadService) chunksInUse(fileMD5 string) bool {
+	inProgress, err := s.uploadRepo.CountInProgressUploads(fileMD5)
+	if err != nil {
+		log.Warnf("[Upload] 统计未完成上传失败，暂不删除分片, fileMD5: %s, error: %v", fileMD5, err)
+		return true
+	}
+	return inProgress > 0
+}
 
-		objectsCh := make(chan minio.ObjectInfo)
-		go func() {
-			defer close(objectsCh)
-			for i := 0; i < totalChunks; i++ {
-				objectsCh <- minio.ObjectInfo{Key: fmt.Sprintf("chunks/%s/%d", fileMD5, i)}
+// removeChunkObjects 删除 MinIO 中文件的全部分片对象，不存在的对象会被忽略。
+func (s *uploadService) removeChunkObjects(ctx context.Context, fileMD5 string, totalChunks int) {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for i := 0; i < totalChunks; i++ {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: fmt.Sprintf("chunks/%s/%d", fileMD5, i)}:
+			case <-ctx.Done():
+				return
 			}
-		}()
-		// Note: This is a fire-and-forget cleanup. In a production system,
-		// you might want a more robust mechanism to handle cleanup failures.
-		for range storage.MinioClient.RemoveObjects(bgCtx, s.minioCfg.BucketName, objectsCh, minio.RemoveObjectsOptions{}) {
-			// We can log errors here if needed, but we don't block the main flow.
 		}
-		log.Infof("[MergeChunks] 后台清理任务完成。文件MD5: %s", fileMD5)
 	}()
+	for removeErr := range storage.MinioClient.RemoveObjects(ctx, s.minioCfg.BucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+		log.Warnf("[Upload] 删除分片 %s 失败: %v", removeErr.ObjectName, removeErr.Err)
+	}
+}
 
-	return objectURL, nil
+// GetStaleUploadReport 列出超过保留时长未再上传分片的未完成上传，不做任何修改。
+func (s *uploadService) GetStaleUploadReport(ctx context.Context) (*StaleUploadReport, error) {
+	ttl := s.uploadCfg.TTL()
+	cutoff := time.Now().Add(-ttl)
+	files, err := s.uploadRepo.FindStaleUploads(cutoff, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StaleUploadReport{TTLHours: ttl.Hours(), Cutoff: cutoff, Count: len(files), Uploads: make([]StaleUpload, 0, len(files))}
+	for _, f := range files {
+		totalChunks := s.calculateTotalChunks(f.TotalSize)
+		uploaded, err := s.uploadRepo.GetUploadedChunksFromRedis(ctx, f.FileMD5, f.UserID, totalChunks)
+		if err != nil {
+			return nil, err
+		}
+		report.Uploads = append(report.Uploads, StaleUpload{
+			FileMD5:        f.FileMD5,
+			FileName:       f.FileName,
+			UserID:         f.UserID,
+			TotalSize:      f.TotalSize,
+			UploadedChunks: len(uploaded),
+			TotalChunks:    totalChunks,
+			LastActivityAt: f.LastActivityAt(),
+		})
+	}
+	return report, nil
+}
+
+// CleanupStaleUploads 删除过期的未完成上传：上传记录、Redis 上传标记，以及不再被其他未完成上传使用的
+// 分片对象与分片记录。返回本轮删除的上传数。
+func (s *uploadService) CleanupStaleUploads(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-s.uploadCfg.TTL())
+	files, err := s.uploadRepo.FindStaleUploads(cutoff, staleUploadBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		deleted, err := s.uploadRepo.DeleteStaleUpload(f.ID, cutoff)
+		if err != nil {
+			log.Errorf("[UploadJanitor] 删除过期上传记录失败, fileMD5: %s, userID: %d, error: %v", f.FileMD5, f.UserID, err)
+			continue
+		}
+		if !deleted {
+			// 清理期间已恢复上传或完成合并
+			continue
+		}
+		removed++
+
+		if err := s.uploadRepo.DeleteUploadMark(ctx, f.FileMD5, f.UserID); err != nil {
+			log.Warnf("[UploadJanitor] 删除Redis上传标记失败, fileMD5: %s, error: %v", f.FileMD5, err)
+		}
+		// 其他用户仍在上传同一文件时，分片对象与分片记录由其继续使用
+		if s.chunksInUse(f.FileMD5) {
+			continue
+		}
+		if err := s.uploadRepo.DeleteChunkInfoRecords(f.FileMD5); err != nil {
+			log.Warnf("[UploadJanitor] 删除分片记录失败, fileMD5: %s, error: %v", f.FileMD5, err)
+		}
+		s.removeChunkObjects(ctx, f.FileMD5, s.calculateTotalChunks(f.TotalSize))
+	}
+	if removed > 0 {
+		log.Infof("[UploadJanitor] 过期上传清理完成, 候选: %d, 删除: %d", len(files), removed)
+	}
+	return removed, nil
+}
+
+// hashChunk 计算分片内容的 MD5 与大小，并将读取位置重置到开头以便随后上传。
+func hashChunk(file multipart.File) (string, int64, error) {
+	hash := md5.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
 }
 
 // GetUploadStatus 获取文件的上传状态。
@@ -362,19 +822,29 @@ func (s *uploadService) GetSupportedFileTypes() (map[string]interface{}, error)
 }
 
 // FastUpload provides a dedicated check for fast upload.
-func (s *uploadService) FastUpload(ctx context.Context, fileMD5 string, userID uint) (bool, error) {
+// 与 CheckFile 相同，其他用户已上传过相同内容时为当前用户建立共享该内容的记录。
+func (s *uploadService) FastUpload(ctx context.Context, fileMD5 string, userID uint, opts InstantUploadOptions) (*InstantUploadResult, error) {
 	log.Infof("[FastUpload] 开始秒传（快速上传）检查。文件MD5: %s", fileMD5)
 	record, err := s.uploadRepo.GetFileUploadRecord(fileMD5, userID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			log.Info("[FastUpload] 秒传检查：文件记录不存在，无法秒传。")
-			return false, nil
-		}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		log.Errorf("[FastUpload] 秒传检查失败：查询数据库时出错, error: %v", err)
-		return false, err
+		return nil, err
+	}
+	if record != nil {
+		log.Infof("[FastUpload] 秒传检查：文件记录已存在，状态为 %d。", record.Status)
+		if record.Status == 1 {
+			return &InstantUploadResult{Completed: true}, nil
+		}
+	}
+	linked, challenge, err := s.linkSharedFile(ctx, fileMD5, userID, record, opts, true)
+	if err != nil {
+		log.Errorf("[FastUpload] 秒传检查失败：复用其他用户的文件时出错, error: %v", err)
+		return nil, err
+	}
+	if !linked {
+		log.Info("[FastUpload] 秒传检查：没有可直接复用的已完成文件，无法秒传。")
 	}
-	log.Infof("[FastUpload] 秒传检查：文件记录已存在，状态为 %d。", record.Status)
-	return record.Status == 1, nil
+	return &InstantUploadResult{Completed: linked, Challenge: challenge}, nil
 }
 
 // calculateTotalChunks 根据文件总大小和默认分片大小计算总分片数。
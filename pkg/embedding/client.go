@@ -6,14 +6,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"pai-smart-go/internal/config"
 	"pai-smart-go/pkg/log"
+	"sort"
+	"time"
+)
+
+const (
+	// baseBackoff is the delay before the first retry; it doubles on every attempt.
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 10 * time.Second
 )
 
 // Client defines the interface for an embedding client.
 type Client interface {
 	CreateEmbedding(ctx context.Context, text string) ([]float32, error)
+	// CreateEmbeddings embeds several texts in one request. The returned vectors
+	// are in the same order as the input texts.
+	CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+	// Model returns the model name recorded as model_version alongside the vectors.
+	Model() string
 }
 
 type openAICompatibleClient struct {
@@ -37,16 +51,80 @@ type embeddingRequest struct {
 
 type embeddingResponse struct {
 	Data []struct {
+		Index     int       `json:"index"`
 		Embedding []float32 `json:"embedding"`
 	} `json:"data"`
 }
 
+// statusError is returned when the embedding API answers with a non-200 status.
+type statusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("embedding api returned non-200 status: %s, body: %s", e.Status, e.Body)
+}
+
+// retryable reports whether the request may succeed if sent again (rate limit or server error).
+func (e *statusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Model returns the configured embedding model name.
+func (c *openAICompatibleClient) Model() string {
+	return c.cfg.Model
+}
+
 // CreateEmbedding calls the OpenAI-compatible API to get the vector for a given text.
 func (c *openAICompatibleClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
-	log.Infof("[EmbeddingClient] 开始调用 Embedding API, model: %s, input_len: %d", c.cfg.Model, len(text))
+	vectors, err := c.CreateEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// CreateEmbeddings calls the OpenAI-compatible API with an `input` array and
+// retries with exponential backoff on 429 and 5xx responses.
+func (c *openAICompatibleClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	log.Infof("[EmbeddingClient] 开始调用 Embedding API, model: %s, batch: %d", c.cfg.Model, len(texts))
+
+	maxRetries := c.cfg.Retries()
+	backoff := baseBackoff
+	for attempt := 0; ; attempt++ {
+		vectors, err := c.doRequest(ctx, texts)
+		if err == nil {
+			log.Infof("[EmbeddingClient] 成功从 Embedding API 获取向量, 条数: %d, 维度: %d", len(vectors), len(vectors[0]))
+			return vectors, nil
+		}
+		se, ok := err.(*statusError)
+		if !ok || !se.retryable() || attempt >= maxRetries {
+			log.Errorf("[EmbeddingClient] 调用 Embedding API 失败, attempt: %d, error: %v", attempt+1, err)
+			return nil, err
+		}
+		log.Warnf("[EmbeddingClient] Embedding API 返回 %s, %v 后进行第 %d 次重试", se.Status, backoff, attempt+1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// doRequest sends a single embedding request without retrying.
+func (c *openAICompatibleClient) doRequest(ctx context.Context, texts []string) ([][]float32, error) {
 	reqBody := embeddingRequest{
 		Model:      c.cfg.Model, // Use model from config
-		Input:      []string{text},
+		Input:      texts,
 		Dimensions: c.cfg.Dimensions, // Use dimensions from config
 	}
 
@@ -65,27 +143,33 @@ func (c *openAICompatibleClient) CreateEmbedding(ctx context.Context, text strin
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		log.Errorf("[EmbeddingClient] 调用 Embedding API 失败, error: %v", err)
 		return nil, fmt.Errorf("failed to call embedding api: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Errorf("[EmbeddingClient] Embedding API 返回非 200 状态码: %s", resp.Status)
-		return nil, fmt.Errorf("embedding api returned non-200 status: %s", resp.Status)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, &statusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bodyBytes)}
 	}
 
 	var embeddingResp embeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
-		log.Errorf("[EmbeddingClient] 解析 Embedding API 响应失败, error: %v", err)
 		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
 	}
 
-	if len(embeddingResp.Data) == 0 || len(embeddingResp.Data[0].Embedding) == 0 {
-		log.Warnf("[EmbeddingClient] Embedding API 返回了空的向量数据")
-		return nil, fmt.Errorf("received empty embedding from api")
+	if len(embeddingResp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding api returned %d vectors for %d inputs", len(embeddingResp.Data), len(texts))
 	}
-
-	log.Infof("[EmbeddingClient] 成功从 Embedding API 获取向量, 维度: %d", len(embeddingResp.Data[0].Embedding))
-	return embeddingResp.Data[0].Embedding, nil
+	// The API is not required to keep input order; rely on the index field.
+	sort.Slice(embeddingResp.Data, func(i, j int) bool {
+		return embeddingResp.Data[i].Index < embeddingResp.Data[j].Index
+	})
+	vectors := make([][]float32, len(texts))
+	for i, d := range embeddingResp.Data {
+		if len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("received empty embedding from api")
+		}
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
 }
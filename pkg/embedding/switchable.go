@@ -0,0 +1,58 @@
+package embedding
+
+import (
+	"context"
+	"pai-smart-go/internal/config"
+	"sync"
+)
+
+// SwitchableClient wraps a Client that can be replaced at runtime, so that query
+// embedding and document processing move to a new model together once a reindex
+// has switched the search alias to vectors produced by that model.
+type SwitchableClient struct {
+	mu     sync.RWMutex
+	cfg    config.EmbeddingConfig
+	client Client
+}
+
+// NewSwitchableClient creates a SwitchableClient that starts with the given config.
+func NewSwitchableClient(cfg config.EmbeddingConfig) *SwitchableClient {
+	return &SwitchableClient{cfg: cfg, client: NewClient(cfg)}
+}
+
+// Switch replaces the underlying client; in-flight requests finish on the old one.
+func (c *SwitchableClient) Switch(cfg config.EmbeddingConfig) {
+	client := NewClient(cfg)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	c.client = client
+}
+
+// Config returns the config of the client currently in use.
+func (c *SwitchableClient) Config() config.EmbeddingConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg
+}
+
+func (c *SwitchableClient) current() Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// CreateEmbedding delegates to the current client.
+func (c *SwitchableClient) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return c.current().CreateEmbedding(ctx, text)
+}
+
+// CreateEmbeddings delegates to the current client.
+func (c *SwitchableClient) CreateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return c.current().CreateEmbeddings(ctx, texts)
+}
+
+// Model returns the model name of the current client.
+func (c *SwitchableClient) Model() string {
+	return c.current().Model()
+}
@@ -0,0 +1,146 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"pai-smart-go/pkg/log"
+	"sort"
+	"time"
+)
+
+// VersionedIndexName 生成别名下的新版本索引名，形如 knowledge_base_v20260101150405。
+func VersionedIndexName(alias string) string {
+	return fmt.Sprintf("%s_v%s", alias, time.Now().Format("20060102150405"))
+}
+
+// ResolveIndex 返回名称当前指向的实际索引。
+// 名称是别名时返回其指向的全部索引与 isAlias=true；是普通索引时返回自身；都不存在时返回空列表。
+func ResolveIndex(ctx context.Context, name string) (indices []string, isAlias bool, err error) {
+	res, err := ESClient.Indices.GetAlias(
+		ESClient.Indices.GetAlias.WithContext(ctx),
+		ESClient.Indices.GetAlias.WithName(name),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+		var aliases map[string]json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&aliases); err != nil {
+			return nil, false, fmt.Errorf("解析别名 '%s' 失败: %w", name, err)
+		}
+		for index := range aliases {
+			indices = append(indices, index)
+		}
+		sort.Strings(indices)
+		return indices, true, nil
+	case res.StatusCode == http.StatusNotFound:
+		exists, err := indexExists(ctx, name)
+		if err != nil || !exists {
+			return nil, false, err
+		}
+		return []string{name}, false, nil
+	default:
+		return nil, false, fmt.Errorf("查询别名 '%s' 时 Elasticsearch 返回错误: %s", name, res.String())
+	}
+}
+
+// ShadowAlias 返回重建索引期间指向新版本索引的影子别名，按查询的删除与更新会同时作用于它。
+func ShadowAlias(alias string) string {
+	return alias + "_reindexing"
+}
+
+// CreateVersionedIndex 在别名下创建一个记录了 embedding 模型的新版本索引，并将影子别名指向它，
+// 但不把别名指向它。
+func CreateVersionedIndex(ctx context.Context, alias, model string, dims int) (string, error) {
+	indexName := VersionedIndexName(alias)
+	body := IndexMapping(model, dims)
+	body["aliases"] = map[string]interface{}{ShadowAlias(alias): map[string]interface{}{}}
+	if err := createIndexWithBody(ctx, indexName, body); err != nil {
+		return "", err
+	}
+	return indexName, nil
+}
+
+// SwapAlias 以一次原子的 _aliases 请求将别名切换到 newIndex，并移除 newIndex 上的影子别名。
+// 别名原先指向的索引从别名上移除；若 name 原本是一个普通索引（迁移前的旧部署），
+// 则在同一请求中删除该索引，使同名别名得以建立。
+func SwapAlias(ctx context.Context, alias, newIndex string) error {
+	current, isAlias, err := ResolveIndex(ctx, alias)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]map[string]interface{}, 0, len(current)+1)
+	for _, index := range current {
+		if index == newIndex {
+			continue
+		}
+		if isAlias {
+			actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": index, "alias": alias}})
+		} else {
+			actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": index}})
+		}
+	}
+	actions = append(actions, map[string]interface{}{"add": map[string]interface{}{"index": newIndex, "alias": alias}})
+	// 切换后按查询的修改经别名即作用于新索引，同时移除影子别名（不存在时忽略）
+	actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": newIndex, "alias": ShadowAlias(alias), "must_exist": false}})
+
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	res, err := ESClient.Indices.UpdateAliases(
+		bytes.NewReader(body),
+		ESClient.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Errorf("切换别名 '%s' 到 '%s' 时 Elasticsearch 返回错误: %s", alias, newIndex, res.String())
+		return errors.New("切换索引别名失败")
+	}
+	log.Infof("别名 '%s' 已切换到索引 '%s'", alias, newIndex)
+	return nil
+}
+
+// DeleteIndex 删除指定索引，索引不存在时视为成功。
+func DeleteIndex(ctx context.Context, indexName string) error {
+	res, err := ESClient.Indices.Delete(
+		[]string{indexName},
+		ESClient.Indices.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		log.Errorf("删除索引 '%s' 时 Elasticsearch 返回错误: %s", indexName, res.String())
+		return errors.New("删除索引失败")
+	}
+	return nil
+}
+
+func indexExists(ctx context.Context, name string) (bool, error) {
+	res, err := ESClient.Indices.Exists([]string{name}, ESClient.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("检查索引是否存在时收到意外的状态码: %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,139 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pai-smart-go/internal/model"
+	"pai-smart-go/pkg/log"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+)
+
+// BulkFailure 记录了 _bulk 请求中单个条目的失败原因。
+type BulkFailure struct {
+	VectorID string `json:"vectorId"`
+	Status   int    `json:"status"`
+	Reason   string `json:"reason"`
+}
+
+// BulkResult 汇总了一次批量索引的结果。
+type BulkResult struct {
+	Indexed  uint64
+	Failures []BulkFailure
+}
+
+// BulkIndexer 通过 _bulk API 流式写入 EsDocument。
+// 写入期间不触发 refresh，在 Close 时对索引统一执行一次 refresh。
+type BulkIndexer struct {
+	indexName string
+	indexer   esutil.BulkIndexer
+
+	mu       sync.Mutex
+	added    uint64
+	failures []BulkFailure
+	// requestErr 是首个整体失败的 _bulk 请求的错误（传输错误、非 2xx 或响应无法解析），
+	// 此时 esutil 只调用 OnError，不会为其中的条目调用 OnFailure
+	requestErr error
+}
+
+// NewBulkIndexer 创建一个写入指定索引的批量索引器。
+func NewBulkIndexer(indexName string) (*BulkIndexer, error) {
+	b := &BulkIndexer{indexName: indexName}
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        ESClient,
+		Index:         indexName,
+		NumWorkers:    2,
+		FlushBytes:    5 * 1024 * 1024,
+		FlushInterval: 5 * time.Second,
+		OnError: func(ctx context.Context, err error) {
+			log.Errorf("[BulkIndexer] 批量请求失败, index: %s, error: %v", indexName, err)
+			b.mu.Lock()
+			if b.requestErr == nil {
+				b.requestErr = err
+			}
+			b.mu.Unlock()
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 BulkIndexer 失败: %w", err)
+	}
+	b.indexer = indexer
+	return b, nil
+}
+
+// Add 将一个文档加入批量写入队列，以 VectorID 作为文档 ID。
+func (b *BulkIndexer) Add(ctx context.Context, doc model.EsDocument) error {
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	err = b.indexer.Add(ctx, esutil.BulkIndexerItem{
+		Action:     "index",
+		DocumentID: doc.VectorID,
+		Body:       bytes.NewReader(docBytes),
+		OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+			reason := res.Error.Reason
+			if err != nil {
+				reason = err.Error()
+			}
+			b.mu.Lock()
+			b.failures = append(b.failures, BulkFailure{VectorID: item.DocumentID, Status: res.Status, Reason: reason})
+			b.mu.Unlock()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.added++
+	b.mu.Unlock()
+	return nil
+}
+
+// Close 刷出剩余文档，等待所有请求完成，然后对索引执行一次 refresh。
+// 单条文档的失败记录在返回的 BulkResult 中，而不是作为 error 返回；
+// 整个 _bulk 请求失败、或写入数与加入数不一致时返回 error。
+func (b *BulkIndexer) Close(ctx context.Context) (*BulkResult, error) {
+	if err := b.indexer.Close(ctx); err != nil {
+		return nil, fmt.Errorf("关闭 BulkIndexer 失败: %w", err)
+	}
+	stats := b.indexer.Stats()
+
+	b.mu.Lock()
+	result := &BulkResult{Indexed: stats.NumIndexed, Failures: b.failures}
+	added, requestErr := b.added, b.requestErr
+	b.mu.Unlock()
+
+	if err := RefreshIndex(ctx, b.indexName); err != nil {
+		return result, err
+	}
+	if requestErr != nil {
+		return result, fmt.Errorf("批量写入索引 '%s' 失败，已写入 %d/%d 个文档: %w", b.indexName, stats.NumIndexed, added, requestErr)
+	}
+	if stats.NumIndexed+uint64(len(result.Failures)) != added {
+		return result, fmt.Errorf("批量写入索引 '%s' 不完整，已写入 %d/%d 个文档，失败 %d 个", b.indexName, stats.NumIndexed, added, len(result.Failures))
+	}
+	return result, nil
+}
+
+// RefreshIndex 对索引执行一次 refresh，使此前写入的文档可被检索。
+func RefreshIndex(ctx context.Context, indexName string) error {
+	res, err := ESClient.Indices.Refresh(
+		ESClient.Indices.Refresh.WithContext(ctx),
+		ESClient.Indices.Refresh.WithIndex(indexName),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Errorf("刷新索引 '%s' 时 Elasticsearch 返回错误: %s", indexName, res.String())
+		return errors.New("failed to refresh index")
+	}
+	return nil
+}
@@ -12,7 +12,6 @@ import (
 	"pai-smart-go/internal/config"
 	"pai-smart-go/internal/model"
 	"pai-smart-go/pkg/log"
-	"strings"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
@@ -20,8 +19,8 @@ import (
 
 var ESClient *elasticsearch.Client
 
-// InitES 初始化 Elasticsearch 客户端
-func InitES(esCfg config.ElasticsearchConfig) error {
+// InitES 初始化 Elasticsearch 客户端，并确保索引存在且向量维度与 embedding 模型一致。
+func InitES(esCfg config.ElasticsearchConfig, embeddingCfg config.EmbeddingConfig) error {
 	cfg := elasticsearch.Config{
 		Addresses: []string{esCfg.Addresses},
 		Username:  esCfg.Username,
@@ -35,70 +34,7 @@ func InitES(esCfg config.ElasticsearchConfig) error {
 		return err
 	}
 	ESClient = client
-	return createIndexIfNotExists(esCfg.IndexName)
-}
-
-// createIndexIfNotExists 检查索引是否存在，如果不存在则创建它
-func createIndexIfNotExists(indexName string) error {
-	res, err := ESClient.Indices.Exists([]string{indexName})
-	if err != nil {
-		log.Errorf("检查索引是否存在时出错: %v", err)
-		return err
-	}
-	// 如果 res.StatusCode 是 200，说明索引已存在
-	if !res.IsError() && res.StatusCode == http.StatusOK {
-		log.Infof("索引 '%s' 已存在", indexName)
-		return nil
-	}
-	// 如果 res.StatusCode 是 404，说明索引不存在，需要创建
-	if res.StatusCode != http.StatusNotFound {
-		log.Errorf("检查索引 '%s' 是否存在时收到意外的状态码: %d", indexName, res.StatusCode)
-		return fmt.Errorf("检查索引是否存在时收到意外的状态码: %d", res.StatusCode)
-	}
-
-	// 完全对齐 Java 项目的 knowledge_base.json 结构
-	// 使用 ik 中文分词器，并指定向量维度为 2048 和 cosine 相似度
-	mapping := `{
-		"mappings": {
-			"properties": {
-				"vector_id": { "type": "keyword" },
-				"file_md5": { "type": "keyword" },
-				"chunk_id": { "type": "integer" },
-				"text_content": { 
-					"type": "text",
-					"analyzer": "ik_max_word",
-					"search_analyzer": "ik_smart" 
-				},
-				"vector": {
-					"type": "dense_vector",
-					"dims": 2048,
-					"index": true,
-					"similarity": "cosine"
-				},
-				"model_version": { "type": "keyword" },
-				"user_id": { "type": "long" },
-				"org_tag": { "type": "keyword" },
-				"is_public": { "type": "boolean" }
-			}
-		}
-	}`
-
-	res, err = ESClient.Indices.Create(
-		indexName,
-		ESClient.Indices.Create.WithBody(strings.NewReader(mapping)),
-	)
-
-	if err != nil {
-		log.Errorf("创建索引 '%s' 失败: %v", indexName, err)
-		return err
-	}
-	if res.IsError() {
-		log.Errorf("创建索引 '%s' 时 Elasticsearch 返回错误: %s", indexName, res.String())
-		return errors.New("创建索引时 Elasticsearch 返回错误")
-	}
-
-	log.Infof("索引 '%s' 创建成功", indexName)
-	return nil
+	return EnsureIndex(context.Background(), esCfg.IndexName, embeddingCfg.Model, embeddingCfg.Dimensions)
 }
 
 // IndexDocument 将单个文档向量索引到 Elasticsearch。
@@ -128,3 +64,129 @@ func IndexDocument(ctx context.Context, indexName string, doc model.EsDocument)
 
 	return nil
 }
+
+// writeTargets 返回按查询修改文档时的目标：索引本身，以及重建索引期间指向新索引的影子别名，
+// 使删除与所有者变更同时作用于正在重建的索引。影子别名不存在时被忽略。
+func writeTargets(indexName string) []string {
+	return []string{indexName, ShadowAlias(indexName)}
+}
+
+// DeleteByFileMD5 删除索引中属于指定文件的全部分块，删除后立即 refresh，使其不再被检索到。
+func DeleteByFileMD5(ctx context.Context, indexName, fileMD5 string) (int64, error) {
+	query := map[string]interface{}{
+		"term": map[string]interface{}{"file_md5": fileMD5},
+	}
+	return deleteByQuery(ctx, indexName, fileMD5, query)
+}
+
+// DeleteChunksFrom 删除指定文件中 chunk_id >= fromChunkID 的分块，用于重新分块后清理多出的旧分块。
+func DeleteChunksFrom(ctx context.Context, indexName, fileMD5 string, fromChunkID int) (int64, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []map[string]interface{}{
+				{"term": map[string]interface{}{"file_md5": fileMD5}},
+				{"range": map[string]interface{}{"chunk_id": map[string]interface{}{"gte": fromChunkID}}},
+			},
+		},
+	}
+	return deleteByQuery(ctx, indexName, fileMD5, query)
+}
+
+// deleteByQuery 删除匹配 query 的分块并立即 refresh，返回删除数。
+func deleteByQuery(ctx context.Context, indexName, fileMD5 string, query map[string]interface{}) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := ESClient.DeleteByQuery(
+		writeTargets(indexName),
+		bytes.NewReader(body),
+		ESClient.DeleteByQuery.WithContext(ctx),
+		ESClient.DeleteByQuery.WithConflicts("proceed"),
+		ESClient.DeleteByQuery.WithRefresh(true),
+		ESClient.DeleteByQuery.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Errorf("按 file_md5 删除 Elasticsearch 文档出错: %s", res.String())
+		return 0, errors.New("failed to delete documents by file_md5")
+	}
+
+	var result struct {
+		Deleted  int64             `json:"deleted"`
+		Failures []json.RawMessage `json:"failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("解析 delete_by_query 响应失败: %w", err)
+	}
+	if len(result.Failures) > 0 {
+		return result.Deleted, fmt.Errorf("delete_by_query 部分失败 (file_md5=%s): %s", fileMD5, string(result.Failures[0]))
+	}
+	return result.Deleted, nil
+}
+
+// UpdateOwners 将指定文件全部分块的所有者字段（user_id、org_tag、is_public）替换为 owners，
+// 并同步其中最早记录的 file_type 与 uploaded_at，用于跨用户秒传与共享文件的删除，无需重新向量化。
+// 完成后立即 refresh，返回更新的分块数。
+func UpdateOwners(ctx context.Context, indexName, fileMD5 string, owners model.DocumentOwners) (int64, error) {
+	orgTags := owners.OrgTags
+	if orgTags == nil {
+		orgTags = model.StringList{}
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"file_md5": fileMD5},
+		},
+		"script": map[string]interface{}{
+			"lang": "painless",
+			"source": "ctx._source.user_id = params.user_id; ctx._source.org_tag = params.org_tag; ctx._source.is_public = params.is_public; " +
+				"if (params.uploaded_at != null) { ctx._source.uploaded_at = params.uploaded_at; ctx._source.file_type = params.file_type }",
+			"params": map[string]interface{}{
+				"user_id":     owners.UserIDs,
+				"org_tag":     orgTags,
+				"is_public":   owners.IsPublic,
+				"file_type":   owners.FileType,
+				"uploaded_at": owners.UploadedAt,
+			},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := ESClient.UpdateByQuery(
+		writeTargets(indexName),
+		ESClient.UpdateByQuery.WithContext(ctx),
+		ESClient.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		ESClient.UpdateByQuery.WithConflicts("proceed"),
+		ESClient.UpdateByQuery.WithRefresh(true),
+		ESClient.UpdateByQuery.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Errorf("按 file_md5 更新 Elasticsearch 文档所有者出错: %s", res.String())
+		return 0, errors.New("failed to update document owners by file_md5")
+	}
+
+	var result struct {
+		Updated  int64             `json:"updated"`
+		Failures []json.RawMessage `json:"failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("解析 update_by_query 响应失败: %w", err)
+	}
+	if len(result.Failures) > 0 {
+		return result.Updated, fmt.Errorf("update_by_query 部分失败 (file_md5=%s): %s", fileMD5, string(result.Failures[0]))
+	}
+	return result.Updated, nil
+}
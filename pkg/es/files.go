@@ -0,0 +1,165 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"pai-smart-go/internal/model"
+)
+
+// FileSummary 汇总索引中一个文件的分块数，以及取自其任一分块的所有者字段。
+type FileSummary struct {
+	FileMD5 string
+	Chunks  int64
+	Owners  model.DocumentOwners
+}
+
+// ScanFiles 以 composite 聚合按 file_md5 分页遍历索引中的全部文件，每页调用一次 fn。
+// 调用前应确保索引已 refresh，否则最近写入的分块不会被统计。
+func ScanFiles(ctx context.Context, indexName string, pageSize int, fn func(files []FileSummary) error) error {
+	var after map[string]interface{}
+	for {
+		composite := map[string]interface{}{
+			"size": pageSize,
+			"sources": []map[string]interface{}{
+				{"file_md5": map[string]interface{}{"terms": map[string]interface{}{"field": "file_md5"}}},
+			},
+		}
+		if after != nil {
+			composite["after"] = after
+		}
+		query := map[string]interface{}{
+			"size": 0,
+			"aggs": map[string]interface{}{
+				"files": map[string]interface{}{
+					"composite": composite,
+					"aggs": map[string]interface{}{
+						"owner": map[string]interface{}{
+							"top_hits": map[string]interface{}{
+								"size":    1,
+								"_source": []string{"user_id", "org_tag", "is_public"},
+							},
+						},
+					},
+				},
+			},
+		}
+		body, err := json.Marshal(query)
+		if err != nil {
+			return err
+		}
+
+		res, err := ESClient.Search(
+			ESClient.Search.WithContext(ctx),
+			ESClient.Search.WithIndex(indexName),
+			ESClient.Search.WithBody(bytes.NewReader(body)),
+		)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Aggregations struct {
+				Files struct {
+					AfterKey map[string]interface{} `json:"after_key"`
+					Buckets  []struct {
+						Key struct {
+							FileMD5 string `json:"file_md5"`
+						} `json:"key"`
+						DocCount int64 `json:"doc_count"`
+						Owner    struct {
+							Hits struct {
+								Hits []struct {
+									Source model.EsDocument `json:"_source"`
+								} `json:"hits"`
+							} `json:"hits"`
+						} `json:"owner"`
+					} `json:"buckets"`
+				} `json:"files"`
+			} `json:"aggregations"`
+		}
+		if res.IsError() {
+			res.Body.Close()
+			return fmt.Errorf("遍历索引 '%s' 中的文件失败: %s", indexName, res.String())
+		}
+		err = json.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("解析索引 '%s' 的文件聚合失败: %w", indexName, err)
+		}
+
+		buckets := result.Aggregations.Files.Buckets
+		if len(buckets) == 0 {
+			return nil
+		}
+		files := make([]FileSummary, 0, len(buckets))
+		for _, b := range buckets {
+			summary := FileSummary{FileMD5: b.Key.FileMD5, Chunks: b.DocCount}
+			if hits := b.Owner.Hits.Hits; len(hits) > 0 {
+				summary.Owners = model.DocumentOwners{
+					UserIDs:  hits[0].Source.UserID,
+					OrgTags:  hits[0].Source.OrgTag,
+					IsPublic: hits[0].Source.IsPublic,
+				}
+			}
+			files = append(files, summary)
+		}
+		if err := fn(files); err != nil {
+			return err
+		}
+		if result.Aggregations.Files.AfterKey == nil {
+			return nil
+		}
+		after = result.Aggregations.Files.AfterKey
+	}
+}
+
+// CountFiles 统计索引中每个文件的分块数，键为 file_md5，索引中没有分块的文件不出现在结果中。
+func CountFiles(ctx context.Context, indexName string, md5s []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(md5s))
+	if len(md5s) == 0 {
+		return counts, nil
+	}
+	query := map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"terms": map[string]interface{}{"file_md5": md5s}},
+		"aggs": map[string]interface{}{
+			"files": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "file_md5", "size": len(md5s)},
+			},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ESClient.Search(
+		ESClient.Search.WithContext(ctx),
+		ESClient.Search.WithIndex(indexName),
+		ESClient.Search.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("统计索引 '%s' 中文件的分块数失败: %s", indexName, res.String())
+	}
+	var result struct {
+		Aggregations struct {
+			Files struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int64  `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"files"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析索引 '%s' 的文件分块数失败: %w", indexName, err)
+	}
+	for _, b := range result.Aggregations.Files.Buckets {
+		counts[b.Key] = b.DocCount
+	}
+	return counts, nil
+}
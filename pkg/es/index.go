@@ -0,0 +1,205 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pai-smart-go/pkg/log"
+)
+
+// vectorField 是存放文本向量的 dense_vector 字段名。
+const vectorField = "vector"
+
+// metaModelKey 是 mapping _meta 中记录生成索引向量的 embedding 模型的键。
+const metaModelKey = "embedding_model"
+
+// IndexMapping 根据 embedding 模型与向量维度生成知识库索引的 mappings，模型记录在 _meta 中。
+// 字段结构对齐 Java 项目的 knowledge_base.json：ik 中文分词器，cosine 相似度。
+func IndexMapping(model string, dims int) map[string]interface{} {
+	return map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"_meta": map[string]interface{}{metaModelKey: model},
+			"properties": map[string]interface{}{
+				"vector_id": map[string]interface{}{"type": "keyword"},
+				"file_md5":  map[string]interface{}{"type": "keyword"},
+				"chunk_id":  map[string]interface{}{"type": "integer"},
+				"text_content": map[string]interface{}{
+					"type":            "text",
+					"analyzer":        "ik_max_word",
+					"search_analyzer": "ik_smart",
+				},
+				vectorField: map[string]interface{}{
+					"type":       "dense_vector",
+					"dims":       dims,
+					"index":      true,
+					"similarity": "cosine",
+				},
+				"model_version": map[string]interface{}{"type": "keyword"},
+				"user_id":       map[string]interface{}{"type": "long"},
+				"org_tag":       map[string]interface{}{"type": "keyword"},
+				"is_public":     map[string]interface{}{"type": "boolean"},
+				"file_type":     map[string]interface{}{"type": "keyword"},
+				"uploaded_at":   map[string]interface{}{"type": "date"},
+			},
+		},
+	}
+}
+
+// addedFields 是初始 mapping 之后新增的字段，启动时补充到已存在的索引上，
+// 避免新写入的文档被动态映射为 text 类型而无法用于过滤与聚合。
+func addedFields() map[string]interface{} {
+	return map[string]interface{}{
+		"file_type":   map[string]interface{}{"type": "keyword"},
+		"uploaded_at": map[string]interface{}{"type": "date"},
+	}
+}
+
+// EnsureIndex 确保索引存在且向量维度与 embedding 模型一致：
+// 名称不存在时创建一个版本索引并以该名称作为别名指向它，以便之后无停机重建；
+// 已存在（别名或旧部署的普通索引）时读取其 mapping，维度或记录的模型不一致则返回错误。
+func EnsureIndex(ctx context.Context, indexName, model string, dims int) error {
+	if dims <= 0 {
+		return fmt.Errorf("embedding.dimensions 必须为正数，当前为 %d", dims)
+	}
+
+	exists, err := indexExists(ctx, indexName)
+	if err != nil {
+		log.Errorf("检查索引 '%s' 是否存在时出错: %v", indexName, err)
+		return err
+	}
+	if exists {
+		if err := validateIndex(ctx, indexName, model, dims); err != nil {
+			return err
+		}
+		return putMapping(ctx, indexName, map[string]interface{}{"properties": addedFields()})
+	}
+
+	body := IndexMapping(model, dims)
+	body["aliases"] = map[string]interface{}{indexName: map[string]interface{}{}}
+	versioned := VersionedIndexName(indexName)
+	if err := createIndexWithBody(ctx, versioned, body); err != nil {
+		return err
+	}
+	log.Infof("别名 '%s' 已指向新建索引 '%s'", indexName, versioned)
+	return nil
+}
+
+// createIndexWithBody 以给定的 settings/mappings/aliases 创建索引。
+func createIndexWithBody(ctx context.Context, indexName string, body map[string]interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := ESClient.Indices.Create(
+		indexName,
+		ESClient.Indices.Create.WithContext(ctx),
+		ESClient.Indices.Create.WithBody(bytes.NewReader(data)),
+	)
+	if err != nil {
+		log.Errorf("创建索引 '%s' 失败: %v", indexName, err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		log.Errorf("创建索引 '%s' 时 Elasticsearch 返回错误: %s", indexName, res.String())
+		return errors.New("创建索引时 Elasticsearch 返回错误")
+	}
+
+	log.Infof("索引 '%s' 创建成功", indexName)
+	return nil
+}
+
+// putMapping 更新已存在的索引（或别名指向的全部索引）的 mapping，可追加字段或替换 _meta；
+// 字段已存在且类型相同时无副作用。
+func putMapping(ctx context.Context, indexName string, mapping map[string]interface{}) error {
+	data, err := json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	res, err := ESClient.Indices.PutMapping(
+		[]string{indexName},
+		bytes.NewReader(data),
+		ESClient.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		log.Errorf("更新索引 '%s' 的 mapping 失败: %v", indexName, err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("更新索引 '%s' 的 mapping 失败: %s", indexName, res.String())
+	}
+	return nil
+}
+
+// IndexEmbedding 描述一个索引的向量维度与生成其向量的 embedding 模型（旧索引未记录模型时为空）。
+type IndexEmbedding struct {
+	Dims  int
+	Model string
+}
+
+// IndexEmbeddings 读取索引（或别名指向的全部索引）的向量维度与 embedding 模型，键为实际索引名。
+func IndexEmbeddings(ctx context.Context, indexName string) (map[string]IndexEmbedding, error) {
+	res, err := ESClient.Indices.GetMapping(
+		ESClient.Indices.GetMapping.WithContext(ctx),
+		ESClient.Indices.GetMapping.WithIndex(indexName),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("获取索引 '%s' 的 mapping 失败: %s", indexName, res.String())
+	}
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta       map[string]interface{} `json:"_meta"`
+			Properties map[string]struct {
+				Type string `json:"type"`
+				Dims int    `json:"dims"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("解析索引 '%s' 的 mapping 失败: %w", indexName, err)
+	}
+
+	result := make(map[string]IndexEmbedding, len(mappings))
+	for name, m := range mappings {
+		field, ok := m.Mappings.Properties[vectorField]
+		if !ok || field.Type != "dense_vector" {
+			return nil, fmt.Errorf("索引 '%s' 缺少 dense_vector 字段 '%s'", name, vectorField)
+		}
+		model, _ := m.Mappings.Meta[metaModelKey].(string)
+		result[name] = IndexEmbedding{Dims: field.Dims, Model: model}
+	}
+	return result, nil
+}
+
+// validateIndex 校验已存在索引的向量维度与记录的 embedding 模型均与配置一致。
+// 升级前创建、未记录模型的索引视为由当前配置的模型生成，并补记到 _meta 中。
+func validateIndex(ctx context.Context, indexName, model string, dims int) error {
+	actual, err := IndexEmbeddings(ctx, indexName)
+	if err != nil {
+		return err
+	}
+	for name, e := range actual {
+		if e.Dims != dims {
+			return fmt.Errorf("索引 '%s' 的向量维度为 %d，与 embedding.dimensions=%d 不一致；请重建索引或调整配置", name, e.Dims, dims)
+		}
+		if e.Model != "" && e.Model != model {
+			return fmt.Errorf("索引 '%s' 的向量由 embedding 模型 %s 生成，与 embedding.model=%s 不一致；重建索引后请同步更新配置", name, e.Model, model)
+		}
+		if e.Model == "" {
+			if err := putMapping(ctx, name, map[string]interface{}{"_meta": map[string]interface{}{metaModelKey: model}}); err != nil {
+				return err
+			}
+			log.Infof("索引 '%s' 未记录 embedding 模型，已记为 %s", name, model)
+		}
+	}
+	log.Infof("索引 '%s' 已存在, 向量维度 %d 与 embedding 模型 %s 与配置一致", indexName, dims, model)
+	return nil
+}
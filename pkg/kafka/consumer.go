@@ -0,0 +1,571 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pai-smart-go/internal/config"
+	"pai-smart-go/pkg/log"
+	"pai-smart-go/pkg/tasks"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// 未配置 kafka.workers / max_attempts / retry_backoff_seconds / max_retry_backoff_seconds 时的默认值。
+	defaultWorkers         = 4
+	defaultMaxAttempts     = 3
+	defaultRetryBackoff    = 10 * time.Second
+	defaultMaxRetryBackoff = 10 * time.Minute
+
+	// handOffInterval 是写入重试或死信主题失败后再次尝试的间隔。
+	handOffInterval = 5 * time.Second
+
+	// 读取消息出错后重建 reader 的退避区间。
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+
+	// drainTimeout 是收到停止信号后等待在途任务完成的最长时间，超时后取消这些任务，
+	// 它们的 offset 不会提交，重启后重新投递。应小于 main 中的 shutdownTimeout。
+	drainTimeout = 25 * time.Second
+
+	// 重试消息通过 header 携带已处理次数、最早可处理时间与上次的错误。
+	headerAttempt   = "x-attempt"
+	headerNotBefore = "x-not-before"
+	headerLastError = "x-last-error"
+)
+
+// 工作协程的状态。
+const (
+	WorkerStateIdle    = "idle"
+	WorkerStateBusy    = "busy"
+	WorkerStateStopped = "stopped"
+)
+
+// WorkerHealth 是单个工作协程的运行状况。
+type WorkerHealth struct {
+	ID            int        `json:"id"`
+	State         string     `json:"state"`
+	FileMD5       string     `json:"fileMd5,omitempty"`
+	TaskStartedAt *time.Time `json:"taskStartedAt,omitempty"`
+	Processed     int64      `json:"processed"`
+	Failed        int64      `json:"failed"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastActiveAt  *time.Time `json:"lastActiveAt,omitempty"`
+}
+
+// TopicHealth 是单个主题消费者及其工作协程的运行状况。
+type TopicHealth struct {
+	Topic          string         `json:"topic"`
+	Connected      bool           `json:"connected"`
+	Reconnects     int            `json:"reconnects"`
+	LastFetchError string         `json:"lastFetchError,omitempty"`
+	Workers        []WorkerHealth `json:"workers"`
+}
+
+// ConsumerHealth 汇总所有主题的消费状况；所有主题均已连接时 Healthy 为 true。
+type ConsumerHealth struct {
+	Healthy bool          `json:"healthy"`
+	Topics  []TopicHealth `json:"topics"`
+}
+
+// Consumer 以工作池并发处理主主题与重试主题中的文件任务。
+// 每个主题各有一个拉取协程和 kafka.workers 个工作协程；同一分区的 offset 按拉取顺序提交，
+// 只有在它之前的消息都处理完毕后才会提交，保证进程退出时不会跳过未完成的任务。
+// 处理失败的任务写入重试主题并按指数退避延迟重试，次数耗尽后连同错误写入死信主题并交给 recorder 记录。
+// 未到重试时间的消息由拉取协程暂存、到期后再分发，不占用工作协程，也不阻塞后续消息的拉取与处理。
+type Consumer struct {
+	cfg       config.KafkaConfig
+	processor TaskProcessor
+	recorder  DeadLetterRecorder
+	topics    []*topicConsumer
+}
+
+// NewConsumer 创建一个新的 Consumer 实例，调用 Run 后开始消费。
+func NewConsumer(cfg config.KafkaConfig, processor TaskProcessor, recorder DeadLetterRecorder) *Consumer {
+	c := &Consumer{cfg: cfg, processor: processor, recorder: recorder}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	for _, topic := range []string{cfg.Topic, cfg.RetryTopicName()} {
+		t := &topicConsumer{consumer: c, topic: topic, workers: make([]*worker, workers)}
+		for i := range t.workers {
+			t.workers[i] = &worker{health: WorkerHealth{ID: i, State: WorkerStateIdle}}
+		}
+		c.topics = append(c.topics, t)
+	}
+	return c
+}
+
+// Run 开始消费，直到 ctx 被取消且在途任务全部结束（或超过 drainTimeout）后返回。
+func (c *Consumer) Run(ctx context.Context) {
+	// 任务处理使用独立的上下文：停止拉取后仍给在途任务留出完成的时间
+	procCtx, cancelProc := context.WithCancel(context.Background())
+	defer cancelProc()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-procCtx.Done():
+			return
+		}
+		timer := time.NewTimer(drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.Warnf("等待在途文件任务超时(%s)，取消剩余任务", drainTimeout)
+			cancelProc()
+		case <-procCtx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, t := range c.topics {
+		wg.Add(1)
+		go func(t *topicConsumer) {
+			defer wg.Done()
+			t.run(ctx, procCtx)
+		}(t)
+	}
+	wg.Wait()
+	log.Info("Kafka 消费者已全部退出")
+}
+
+// Health 返回各主题消费者与工作协程的运行状况快照。
+func (c *Consumer) Health() ConsumerHealth {
+	health := ConsumerHealth{Healthy: true, Topics: make([]TopicHealth, 0, len(c.topics))}
+	for _, t := range c.topics {
+		th := t.health()
+		if !th.Connected {
+			health.Healthy = false
+		}
+		health.Topics = append(health.Topics, th)
+	}
+	return health
+}
+
+// topicConsumer 负责单个主题的拉取、分发与提交。
+type topicConsumer struct {
+	consumer *Consumer
+	topic    string
+	workers  []*worker
+
+	mu             sync.Mutex
+	connected      bool
+	reconnects     int
+	lastFetchError string
+}
+
+// job 是分发给工作协程的一条消息，处理完毕后通过 tracker 按序提交。
+type job struct {
+	msg     kafka.Message
+	reader  *kafka.Reader
+	tracker *offsetTracker
+	entry   *trackedMessage
+	done    func()
+}
+
+// run 反复创建 reader 拉取消息，读取出错时等待在途任务结束后按指数退避重连。
+func (t *topicConsumer) run(ctx, procCtx context.Context) {
+	jobs := make(chan *job)
+	var workersWG sync.WaitGroup
+	for _, w := range t.workers {
+		workersWG.Add(1)
+		go func(w *worker) {
+			defer workersWG.Done()
+			for j := range jobs {
+				t.work(ctx, procCtx, w, j)
+			}
+			w.setStopped()
+		}(w)
+	}
+
+	backoff := minReconnectBackoff
+	for ctx.Err() == nil {
+		fetched, err := t.fetchLoop(ctx, jobs)
+		if ctx.Err() != nil {
+			break
+		}
+		if fetched {
+			backoff = minReconnectBackoff
+		}
+		t.setDisconnected(err)
+		log.Errorf("从 Kafka 主题 '%s' 读取消息失败，%s 后重连: %v", t.topic, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+
+	close(jobs)
+	workersWG.Wait()
+	t.mu.Lock()
+	t.connected = false
+	t.mu.Unlock()
+	log.Infof("Kafka 消费者 '%s' 已退出", t.topic)
+}
+
+// fetchLoop 使用一个新的 reader 拉取并分发消息，直到读取出错或 ctx 被取消；
+// 返回前等待本轮分发的任务全部结束再关闭 reader，fetched 表示本轮是否成功读到过消息。
+func (t *topicConsumer) fetchLoop(ctx context.Context, jobs chan<- *job) (fetched bool, err error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  []string{t.consumer.cfg.Brokers},
+		Topic:    t.topic,
+		GroupID:  "pai-smart-go-consumer",
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})
+	tracker := newOffsetTracker()
+	var inflight sync.WaitGroup
+	// 暂存的延迟消息随本轮拉取结束而放弃：它们未提交 offset，新的 reader 会重新拉取
+	loopCtx, cancelLoop := context.WithCancel(ctx)
+	defer func() {
+		cancelLoop()
+		inflight.Wait()
+		if closeErr := r.Close(); closeErr != nil {
+			log.Errorf("关闭 Kafka 消费者 '%s' 失败: %v", t.topic, closeErr)
+		}
+	}()
+
+	t.setConnected()
+	log.Infof("Kafka 消费者已启动，正在监听主题 '%s'，工作协程数: %d", t.topic, len(t.workers))
+
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Infof("Kafka 消费者 '%s' 收到停止信号，等待在途任务完成", t.topic)
+				return fetched, nil
+			}
+			return fetched, err
+		}
+		fetched = true
+		log.Infof("收到 Kafka 消息: topic %s, partition %d, offset %d", t.topic, m.Partition, m.Offset)
+
+		inflight.Add(1)
+		j := &job{msg: m, reader: r, tracker: tracker, entry: tracker.add(m), done: inflight.Done}
+		if wait := time.Until(headerTime(m, headerNotBefore)); wait > 0 {
+			log.Infof("文件任务将在 %s 后重试: partition %d, offset %d", wait.Round(time.Second), m.Partition, m.Offset)
+			go dispatchAfter(loopCtx, jobs, j, wait)
+			continue
+		}
+		if !dispatch(ctx, jobs, j) {
+			return fetched, nil
+		}
+	}
+}
+
+// dispatch 将任务交给工作协程，ctx 被取消时放弃并返回 false。
+// 未分发的消息不提交，重启或重连后重新投递。
+func dispatch(ctx context.Context, jobs chan<- *job, j *job) bool {
+	select {
+	case jobs <- j:
+		return true
+	case <-ctx.Done():
+		j.done()
+		return false
+	}
+}
+
+// dispatchAfter 在 wait 之后分发一条未到重试时间的消息。
+// 等待期间该分区之后的 offset 不会被提交，但后续消息照常拉取与处理。
+func dispatchAfter(ctx context.Context, jobs chan<- *job, j *job, wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		dispatch(ctx, jobs, j)
+	case <-ctx.Done():
+		j.done()
+	}
+}
+
+// work 在工作协程中处理一条消息，成功转交后按序提交 offset。
+func (t *topicConsumer) work(ctx, procCtx context.Context, w *worker, j *job) {
+	defer j.done()
+	if !t.consumer.handle(ctx, procCtx, w, j.msg) {
+		// 未处理完毕：不标记完成，该分区之后的 offset 也不会被提交
+		return
+	}
+	if err := j.tracker.complete(context.Background(), j.reader, j.entry); err != nil {
+		log.Errorf("Kafka 消费者 '%s': %v", t.topic, err)
+	}
+}
+
+func (t *topicConsumer) setConnected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected = true
+}
+
+func (t *topicConsumer) setDisconnected(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connected = false
+	t.reconnects++
+	if err != nil {
+		t.lastFetchError = err.Error()
+	}
+}
+
+func (t *topicConsumer) health() TopicHealth {
+	t.mu.Lock()
+	h := TopicHealth{
+		Topic:          t.topic,
+		Connected:      t.connected,
+		Reconnects:     t.reconnects,
+		LastFetchError: t.lastFetchError,
+		Workers:        make([]WorkerHealth, 0, len(t.workers)),
+	}
+	t.mu.Unlock()
+	for _, w := range t.workers {
+		h.Workers = append(h.Workers, w.snapshot())
+	}
+	return h
+}
+
+// handle 处理一条消息，返回 false 表示消息尚未处理完毕、不应提交 offset。
+func (c *Consumer) handle(ctx, procCtx context.Context, w *worker, m kafka.Message) bool {
+	var task tasks.FileProcessingTask
+	if err := json.Unmarshal(m.Value, &task); err != nil {
+		// 消息格式错误，重试也无济于事，直接提交，避免阻塞队列
+		log.Errorf("无法解析 Kafka 消息: %v, value: %s", err, string(m.Value))
+		return true
+	}
+
+	attempt := headerInt(m, headerAttempt) + 1
+	log.Infof("开始处理文件任务: MD5=%s, FileName=%s, 第 %d 次", task.FileMD5, task.FileName, attempt)
+	w.begin(task.FileMD5)
+	err := c.processor.Process(procCtx, task)
+	w.finish(err)
+	if err == nil {
+		log.Infof("文件任务处理成功: MD5=%s", task.FileMD5)
+		return true
+	}
+	if procCtx.Err() != nil {
+		// 因停止而中断的任务不计入重试次数
+		log.Warnf("文件任务因服务停止被中断，将在重启后重新处理: MD5=%s", task.FileMD5)
+		return false
+	}
+	log.Errorf("处理文件任务失败: MD5=%s, 第 %d 次, Error: %v", task.FileMD5, attempt, err)
+
+	if attempt < c.maxAttempts() {
+		delay := c.retryBackoff(attempt)
+		return c.handOff(ctx, "重试主题", func() error {
+			return c.produceRetry(m.Key, m.Value, attempt, delay, err)
+		})
+	}
+
+	deadLetter := tasks.DeadLetterTask{
+		ID:       fmt.Sprintf("%s-%d-%d", m.Topic, m.Partition, m.Offset),
+		Task:     task,
+		Error:    err.Error(),
+		Attempts: attempt,
+		FailedAt: time.Now(),
+	}
+	log.Errorf("文件任务重试 %d 次后仍失败，写入死信主题: MD5=%s, ID=%s", attempt, task.FileMD5, deadLetter.ID)
+	return c.handOff(ctx, "死信主题", func() error {
+		return c.produceDeadLetter(deadLetter)
+	})
+}
+
+// handOff 反复执行 fn 直到成功，确保失败的任务在提交 offset 前已经转交出去。
+// ctx 被取消时放弃并返回 false。
+func (c *Consumer) handOff(ctx context.Context, target string, fn func() error) bool {
+	for {
+		err := fn()
+		if err == nil {
+			return true
+		}
+		log.Errorf("写入%s失败，%s 后重试: %v", target, handOffInterval, err)
+		select {
+		case <-time.After(handOffInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// produceRetry 将任务写入重试主题，delay 之后才会被再次处理。沿用原消息的 key，同一文件的重试落在同一分区。
+func (c *Consumer) produceRetry(key, value []byte, attempt int, delay time.Duration, cause error) error {
+	notBefore := time.Now().Add(delay)
+	log.Infof("文件任务将在 %s 后进行第 %d 次处理", delay, attempt+1)
+	return producer.WriteMessages(context.Background(), kafka.Message{
+		Topic: c.cfg.RetryTopicName(),
+		Key:   key,
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: headerAttempt, Value: []byte(strconv.Itoa(attempt))},
+			{Key: headerNotBefore, Value: []byte(strconv.FormatInt(notBefore.UnixMilli(), 10))},
+			{Key: headerLastError, Value: []byte(cause.Error())},
+		},
+	})
+}
+
+// produceDeadLetter 先记录死信（按 ID 幂等），再写入死信主题。
+func (c *Consumer) produceDeadLetter(task tasks.DeadLetterTask) error {
+	if c.recorder != nil {
+		if err := c.recorder.RecordDeadLetter(context.Background(), task); err != nil {
+			return fmt.Errorf("记录死信任务失败: %w", err)
+		}
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return producer.WriteMessages(context.Background(), kafka.Message{
+		Topic: c.cfg.DeadLetterTopicName(),
+		Key:   []byte(task.ID),
+		Value: data,
+	})
+}
+
+func (c *Consumer) maxAttempts() int {
+	if c.cfg.MaxAttempts > 0 {
+		return c.cfg.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// retryBackoff 返回第 attempt 次失败后的重试延迟：基础延迟按 2^(attempt-1) 增长，不超过上限。
+func (c *Consumer) retryBackoff(attempt int) time.Duration {
+	base := defaultRetryBackoff
+	if c.cfg.RetryBackoffSeconds > 0 {
+		base = time.Duration(c.cfg.RetryBackoffSeconds) * time.Second
+	}
+	limit := defaultMaxRetryBackoff
+	if c.cfg.MaxRetryBackoffSeconds > 0 {
+		limit = time.Duration(c.cfg.MaxRetryBackoffSeconds) * time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// worker 记录单个工作协程的运行状况。
+type worker struct {
+	mu     sync.Mutex
+	health WorkerHealth
+}
+
+func (w *worker) begin(fileMD5 string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.health.State = WorkerStateBusy
+	w.health.FileMD5 = fileMD5
+	w.health.TaskStartedAt = &now
+	w.health.LastActiveAt = &now
+}
+
+func (w *worker) finish(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.health.State = WorkerStateIdle
+	w.health.FileMD5 = ""
+	w.health.TaskStartedAt = nil
+	w.health.LastActiveAt = &now
+	if err != nil {
+		w.health.Failed++
+		w.health.LastError = err.Error()
+	} else {
+		w.health.Processed++
+	}
+}
+
+func (w *worker) setStopped() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.health.State = WorkerStateStopped
+}
+
+func (w *worker) snapshot() WorkerHealth {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.health
+}
+
+// offsetTracker 按分区记录已拉取但尚未提交的消息，保证 offset 按拉取顺序提交。
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int][]*trackedMessage)}
+}
+
+// add 在拉取到消息时按顺序登记它。
+func (t *offsetTracker) add(m kafka.Message) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := &trackedMessage{msg: m}
+	t.partitions[m.Partition] = append(t.partitions[m.Partition], entry)
+	return entry
+}
+
+// complete 将消息标记为已完成，并提交该分区从头开始连续完成的最后一条消息。
+// 提交在锁内进行，避免并发提交导致 offset 回退。
+func (t *offsetTracker) complete(ctx context.Context, r *kafka.Reader, entry *trackedMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry.done = true
+
+	queue := t.partitions[entry.msg.Partition]
+	n := 0
+	for n < len(queue) && queue[n].done {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	last := queue[n-1].msg
+	t.partitions[entry.msg.Partition] = queue[n:]
+	if err := r.CommitMessages(ctx, last); err != nil {
+		return fmt.Errorf("提交 partition %d offset %d 失败: %w", last.Partition, last.Offset, err)
+	}
+	return nil
+}
+
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// headerInt 读取整数 header，缺失或非法时返回 0。
+func headerInt(m kafka.Message, key string) int {
+	n, _ := strconv.Atoi(headerValue(m, key))
+	return n
+}
+
+// headerTime 读取毫秒时间戳 header，缺失或非法时返回零值。
+func headerTime(m kafka.Message, key string) time.Time {
+	ms, err := strconv.ParseInt(headerValue(m, key), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
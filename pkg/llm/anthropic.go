@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pai-smart-go/internal/config"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// anthropicVersion is sent as the anthropic-version header.
+	anthropicVersion = "2023-06-01"
+	// anthropicDefaultMaxTokens is used when no max_tokens is configured; the Messages API requires one.
+	anthropicDefaultMaxTokens = 4096
+)
+
+// anthropicClient speaks the Anthropic Messages API (`/messages`), streamed as typed SSE events.
+type anthropicClient struct {
+	cfg    config.LLMConfig
+	client *http.Client
+}
+
+func newAnthropicClient(cfg config.LLMConfig) Client {
+	return &anthropicClient{
+		cfg:    cfg,
+		client: &http.Client{},
+	}
+}
+
+type anthropicChatRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Stream      bool      `json:"stream"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// StreamChat calls the Messages API and streams the response.
+func (c *anthropicClient) StreamChat(ctx context.Context, prompt string, writer MessageWriter) error {
+	return c.StreamChatMessages(ctx, []Message{{Role: "user", Content: prompt}}, nil, writer)
+}
+
+func (c *anthropicClient) StreamChatMessages(ctx context.Context, messages []Message, gen *GenerationParams, writer MessageWriter) error {
+	gp := resolveGeneration(c.cfg, gen)
+	system, turns := splitSystemMessages(messages)
+	reqBody := anthropicChatRequest{
+		Model:       c.cfg.Model,
+		System:      system,
+		Messages:    turns,
+		MaxTokens:   anthropicDefaultMaxTokens,
+		Stream:      true,
+		Temperature: gp.Temperature,
+		TopP:        gp.TopP,
+	}
+	if gp.MaxTokens != nil {
+		reqBody.MaxTokens = *gp.MaxTokens
+	}
+	headers := map[string]string{
+		"x-api-key":         c.cfg.APIKey,
+		"anthropic-version": anthropicVersion,
+		"Accept":            "text/event-stream",
+	}
+
+	body, err := postStream(ctx, c.client, c.cfg, strings.TrimSuffix(c.cfg.BaseURL, "/")+"/messages", headers, reqBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				continue
+			}
+			if err := writer.WriteMessage(websocket.TextMessage, []byte(event.Delta.Text)); err != nil {
+				return fmt.Errorf("failed to write message to websocket: %w", err)
+			}
+		case "message_stop":
+			return nil
+		case "error":
+			return fmt.Errorf("anthropic stream error: %s: %s", event.Error.Type, event.Error.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read from stream: %w", err)
+	}
+	return nil
+}
+
+// splitSystemMessages moves system messages into the top-level system prompt and merges
+// consecutive messages of the same role, since the Messages API requires alternating turns.
+func splitSystemMessages(messages []Message) (string, []Message) {
+	var system []string
+	turns := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		if n := len(turns); n > 0 && turns[n-1].Role == m.Role {
+			turns[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		turns = append(turns, m)
+	}
+	return strings.Join(system, "\n\n"), turns
+}
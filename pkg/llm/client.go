@@ -2,7 +2,6 @@
 package llm
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,11 +9,14 @@ import (
 	"io"
 	"net/http"
 	"pai-smart-go/internal/config"
+	"sort"
 	"strings"
-
-	"github.com/gorilla/websocket"
+	"sync"
 )
 
+// DefaultProvider is used when the config does not specify a provider.
+const DefaultProvider = "openai"
+
 // MessageWriter defines an interface for writing WebSocket messages.
 // This allows both a standard websocket.Conn and our interceptor to be used.
 type MessageWriter interface {
@@ -29,17 +31,55 @@ type Client interface {
 	StreamChat(ctx context.Context, prompt string, writer MessageWriter) error
 }
 
-type deepseekClient struct {
-	cfg    config.LLMConfig
-	client *http.Client
+// Factory builds a Client for one provider from the LLM config.
+type Factory func(cfg config.LLMConfig) Client
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a provider available under the given name (case-insensitive).
+// Registering the same name twice replaces the previous factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = factory
+}
+
+// Providers returns the names of all registered providers in sorted order.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // NewClient creates a new LLM client based on the provider in the config.
-func NewClient(cfg config.LLMConfig) Client {
-	return &deepseekClient{
-		cfg:    cfg,
-		client: &http.Client{},
+func NewClient(cfg config.LLMConfig) (Client, error) {
+	name := strings.ToLower(cfg.Provider)
+	if name == "" {
+		name = DefaultProvider
+	}
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown llm provider %q, available: %s", cfg.Provider, strings.Join(Providers(), ", "))
 	}
+	return factory(cfg), nil
+}
+
+func init() {
+	Register("openai", newOpenAIClient)
+	Register("deepseek", newOpenAIClient) // DeepSeek 使用 OpenAI 兼容接口
+	Register("ollama", newOllamaClient)
+	Register("anthropic", newAnthropicClient)
+	Register("fake", newFakeClient)
 }
 
 // Message 表示一条角色消息
@@ -48,23 +88,6 @@ type Message struct {
 	Content string `json:"content"`
 }
 
-type chatRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	Temperature *float64  `json:"temperature,omitempty"`
-	TopP        *float64  `json:"top_p,omitempty"`
-	MaxTokens   *int      `json:"max_tokens,omitempty"`
-}
-
-type chatResponse struct {
-	Choices []struct {
-		Delta struct {
-			Content string `json:"content"`
-		} `json:"delta"`
-	} `json:"choices"`
-}
-
 // GenerationParams 控制生成行为
 type GenerationParams struct {
 	Temperature *float64
@@ -72,92 +95,55 @@ type GenerationParams struct {
 	MaxTokens   *int
 }
 
-// StreamChat calls the DeepSeek API for chat completions and streams the response.
-func (c *deepseekClient) StreamChat(ctx context.Context, prompt string, writer MessageWriter) error {
-	// 兼容旧接口：仅发送一条 user 消息，不带生成参数
-	return c.StreamChatMessages(ctx, []Message{{Role: "user", Content: prompt}}, nil, writer)
-}
-
-func (c *deepseekClient) StreamChatMessages(ctx context.Context, messages []Message, gen *GenerationParams, writer MessageWriter) error {
-	reqBody := chatRequest{
-		Model:    c.cfg.Model,
-		Messages: messages,
-		Stream:   true,
-	}
-	// 从配置或传参注入生成参数（传参优先生效）
+// resolveGeneration returns gen if given, otherwise the non-zero generation values from the config.
+func resolveGeneration(cfg config.LLMConfig, gen *GenerationParams) GenerationParams {
 	if gen != nil {
-		reqBody.Temperature = gen.Temperature
-		reqBody.TopP = gen.TopP
-		reqBody.MaxTokens = gen.MaxTokens
-	} else {
-		// 从全局配置注入（若非零值）
-		if c.cfg.Generation.Temperature != 0 {
-			t := c.cfg.Generation.Temperature
-			reqBody.Temperature = &t
-		}
-		if c.cfg.Generation.TopP != 0 {
-			p := c.cfg.Generation.TopP
-			reqBody.TopP = &p
-		}
-		if c.cfg.Generation.MaxTokens != 0 {
-			m := c.cfg.Generation.MaxTokens
-			reqBody.MaxTokens = &m
-		}
+		return *gen
+	}
+	var gp GenerationParams
+	if cfg.Generation.Temperature != 0 {
+		t := cfg.Generation.Temperature
+		gp.Temperature = &t
+	}
+	if cfg.Generation.TopP != 0 {
+		p := cfg.Generation.TopP
+		gp.TopP = &p
+	}
+	if cfg.Generation.MaxTokens != 0 {
+		m := cfg.Generation.MaxTokens
+		gp.MaxTokens = &m
 	}
+	return gp
+}
 
-	reqBytes, err := json.Marshal(reqBody)
+// postStream sends a JSON request and returns the streaming response body.
+// headers carries the provider's auth headers; cfg.Headers are applied last and may override them.
+func postStream(ctx context.Context, client *http.Client, cfg config.LLMConfig, url string, headers map[string]string, body interface{}) (io.ReadCloser, error) {
+	reqBytes, err := json.Marshal(body)
 	if err != nil {
-		return fmt.Errorf("failed to marshal chat request: %w", err)
+		return nil, fmt.Errorf("failed to marshal chat request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/chat/completions", bytes.NewReader(reqBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create chat request: %w", err)
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
-	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
 
-	resp, err := c.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to call chat api: %w", err)
+		return nil, fmt.Errorf("failed to call chat api: %w", err)
 	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("chat api returned non-200 status: %s, body: %s", resp.Status, string(bodyBytes))
-	}
-
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("failed to read from stream: %w", err)
-		}
-
-		if strings.HasPrefix(line, "data: ") {
-			data := strings.TrimPrefix(line, "data: ")
-			if strings.TrimSpace(data) == "[DONE]" {
-				break
-			}
-
-			var chunk chatResponse
-			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-				continue
-			}
-
-			if len(chunk.Choices) > 0 {
-				content := chunk.Choices[0].Delta.Content
-				if err := writer.WriteMessage(websocket.TextMessage, []byte(content)); err != nil {
-					return fmt.Errorf("failed to write message to websocket: %w", err)
-				}
-			}
-		}
+		return nil, fmt.Errorf("chat api returned non-200 status: %s, body: %s", resp.Status, string(bodyBytes))
 	}
-	return nil
+	return resp.Body, nil
 }
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"pai-smart-go/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeChunkRunes is the number of runes the fake provider writes per streamed chunk.
+const fakeChunkRunes = 8
+
+// fakeClient is a deterministic provider for tests and local development without a model.
+// It answers with the last user message prefixed by the configured model name, streamed in fixed-size chunks.
+type fakeClient struct {
+	cfg config.LLMConfig
+}
+
+func newFakeClient(cfg config.LLMConfig) Client {
+	return &fakeClient{cfg: cfg}
+}
+
+// StreamChat streams the fake answer for a single prompt.
+func (c *fakeClient) StreamChat(ctx context.Context, prompt string, writer MessageWriter) error {
+	return c.StreamChatMessages(ctx, []Message{{Role: "user", Content: prompt}}, nil, writer)
+}
+
+func (c *fakeClient) StreamChatMessages(ctx context.Context, messages []Message, gen *GenerationParams, writer MessageWriter) error {
+	var question string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			question = messages[i].Content
+			break
+		}
+	}
+	model := c.cfg.Model
+	if model == "" {
+		model = "fake"
+	}
+	answer := []rune(fmt.Sprintf("[%s] %s", model, question))
+	if gp := resolveGeneration(c.cfg, gen); gp.MaxTokens != nil && len(answer) > *gp.MaxTokens {
+		answer = answer[:*gp.MaxTokens]
+	}
+
+	for start := 0; start < len(answer); start += fakeChunkRunes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := start + fakeChunkRunes
+		if end > len(answer) {
+			end = len(answer)
+		}
+		if err := writer.WriteMessage(websocket.TextMessage, []byte(string(answer[start:end]))); err != nil {
+			return fmt.Errorf("failed to write message to websocket: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pai-smart-go/internal/config"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ollamaClient speaks Ollama's native `/api/chat` API, which streams newline-delimited JSON.
+type ollamaClient struct {
+	cfg    config.LLMConfig
+	client *http.Client
+}
+
+func newOllamaClient(cfg config.LLMConfig) Client {
+	return &ollamaClient{
+		cfg:    cfg,
+		client: &http.Client{},
+	}
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []Message     `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  ollamaOptions `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+}
+
+// StreamChat calls the Ollama chat API and streams the response.
+func (c *ollamaClient) StreamChat(ctx context.Context, prompt string, writer MessageWriter) error {
+	return c.StreamChatMessages(ctx, []Message{{Role: "user", Content: prompt}}, nil, writer)
+}
+
+func (c *ollamaClient) StreamChatMessages(ctx context.Context, messages []Message, gen *GenerationParams, writer MessageWriter) error {
+	gp := resolveGeneration(c.cfg, gen)
+	reqBody := ollamaChatRequest{
+		Model:    c.cfg.Model,
+		Messages: messages,
+		Stream:   true,
+		Options:  ollamaOptions{Temperature: gp.Temperature, TopP: gp.TopP, NumPredict: gp.MaxTokens},
+	}
+	// 本地 Ollama 默认无需鉴权；经反向代理暴露时可通过 api_key 传递 Bearer token
+	headers := map[string]string{}
+	if c.cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + c.cfg.APIKey
+	}
+
+	// 兼容为 OpenAI 兼容接口配置的 base_url（如 http://localhost:11434/v1）
+	baseURL := strings.TrimSuffix(strings.TrimSuffix(c.cfg.BaseURL, "/"), "/v1")
+	body, err := postStream(ctx, c.client, c.cfg, baseURL+"/api/chat", headers, reqBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("ollama stream error: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			if err := writer.WriteMessage(websocket.TextMessage, []byte(chunk.Message.Content)); err != nil {
+				return fmt.Errorf("failed to write message to websocket: %w", err)
+			}
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read from stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"pai-smart-go/internal/config"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// openAIClient speaks the OpenAI `/chat/completions` SSE dialect (OpenAI, DeepSeek, vLLM, ...).
+type openAIClient struct {
+	cfg    config.LLMConfig
+	client *http.Client
+}
+
+func newOpenAIClient(cfg config.LLMConfig) Client {
+	return &openAIClient{
+		cfg:    cfg,
+		client: &http.Client{},
+	}
+}
+
+type openAIChatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
+	MaxTokens   *int      `json:"max_tokens,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// StreamChat calls the chat completions API and streams the response.
+func (c *openAIClient) StreamChat(ctx context.Context, prompt string, writer MessageWriter) error {
+	// 兼容旧接口：仅发送一条 user 消息，不带生成参数
+	return c.StreamChatMessages(ctx, []Message{{Role: "user", Content: prompt}}, nil, writer)
+}
+
+func (c *openAIClient) StreamChatMessages(ctx context.Context, messages []Message, gen *GenerationParams, writer MessageWriter) error {
+	gp := resolveGeneration(c.cfg, gen)
+	reqBody := openAIChatRequest{
+		Model:       c.cfg.Model,
+		Messages:    messages,
+		Stream:      true,
+		Temperature: gp.Temperature,
+		TopP:        gp.TopP,
+		MaxTokens:   gp.MaxTokens,
+	}
+	headers := map[string]string{
+		"Authorization": "Bearer " + c.cfg.APIKey,
+		"Accept":        "text/event-stream",
+	}
+
+	body, err := postStream(ctx, c.client, c.cfg, c.cfg.BaseURL+"/chat/completions", headers, reqBody)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read from stream: %w", err)
+		}
+
+		if strings.HasPrefix(line, "data: ") {
+			data := strings.TrimPrefix(line, "data: ")
+			if strings.TrimSpace(data) == "[DONE]" {
+				break
+			}
+
+			var chunk openAIChatResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				continue
+			}
+
+			if len(chunk.Choices) > 0 {
+				content := chunk.Choices[0].Delta.Content
+				if err := writer.WriteMessage(websocket.TextMessage, []byte(content)); err != nil {
+					return fmt.Errorf("failed to write message to websocket: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package rerank provides clients for cross-encoder reranking models.
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"pai-smart-go/internal/config"
+	"pai-smart-go/pkg/log"
+	"sort"
+)
+
+// Result is the relevance of one document. Index refers to the position in the
+// documents slice passed to Rerank.
+type Result struct {
+	Index int
+	Score float64
+}
+
+// Reranker scores (query, document) pairs with a rerank model.
+type Reranker interface {
+	// Rerank returns at most topN results ordered by descending relevance.
+	Rerank(ctx context.Context, query string, documents []string, topN int) ([]Result, error)
+	// Model returns the rerank model name.
+	Model() string
+}
+
+type httpClient struct {
+	cfg    config.RerankConfig
+	client *http.Client
+}
+
+// NewClient creates a reranker for Cohere- and Jina-style `/rerank` endpoints.
+// It returns nil when reranking is disabled in the config.
+func NewClient(cfg config.RerankConfig) Reranker {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &httpClient{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout()},
+	}
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// Model returns the configured rerank model name.
+func (c *httpClient) Model() string {
+	return c.cfg.Model
+}
+
+// Rerank calls POST {base_url}/rerank.
+func (c *httpClient) Rerank(ctx context.Context, query string, documents []string, topN int) ([]Result, error) {
+	if len(documents) == 0 {
+		return []Result{}, nil
+	}
+	reqBytes, err := json.Marshal(rerankRequest{
+		Model:     c.cfg.Model,
+		Query:     query,
+		Documents: documents,
+		TopN:      topN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.BaseURL+"/rerank", bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call rerank api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("rerank api returned non-200 status: %s, body: %s", resp.Status, string(bodyBytes))
+	}
+
+	var rerankResp rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rerankResp); err != nil {
+		return nil, fmt.Errorf("failed to decode rerank response: %w", err)
+	}
+
+	results := make([]Result, 0, len(rerankResp.Results))
+	for _, r := range rerankResp.Results {
+		if r.Index < 0 || r.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank api returned out-of-range index %d for %d documents", r.Index, len(documents))
+		}
+		results = append(results, Result{Index: r.Index, Score: r.RelevanceScore})
+	}
+	// Providers already sort by relevance, but do not rely on it.
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if topN > 0 && len(results) > topN {
+		results = results[:topN]
+	}
+	log.Infof("[RerankClient] 重排序完成, model: %s, 候选: %d, 返回: %d", c.cfg.Model, len(documents), len(results))
+	return results, nil
+}
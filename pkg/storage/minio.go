@@ -3,6 +3,11 @@ package storage
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"pai-smart-go/internal/config"
 	"pai-smart-go/pkg/log"
 	"time"
@@ -58,3 +63,47 @@ func GetPresignedURL(bucketName, objectName string, expiry time.Duration) (strin
 	}
 	return presignedURL.String(), nil
 }
+
+// ObjectMD5 流式读取对象并计算其内容的 MD5（十六进制小写），同时返回读取到的字节数。
+// 合并（compose）产生的对象 ETag 不是内容 MD5，需要完整读取一遍才能校验。
+func ObjectMD5(ctx context.Context, bucketName, objectName string) (string, int64, error) {
+	object, err := MinioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	defer object.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(hash, object)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// ObjectRangeSHA256 计算对象 [offset, offset+length) 字节的 SHA-256（十六进制小写），length 为 0 时为空内容的摘要。
+func ObjectRangeSHA256(ctx context.Context, bucketName, objectName string, offset, length int64) (string, error) {
+	if length <= 0 {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return "", err
+	}
+	object, err := MinioClient.GetObject(ctx, bucketName, objectName, opts)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, object)
+	if err != nil {
+		return "", err
+	}
+	if n != length {
+		return "", fmt.Errorf("读取对象 '%s' 的字节范围不完整：期望 %d 字节，实际 %d 字节", objectName, length, n)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -1,12 +1,25 @@
 // Package tasks defines the structure for tasks that are sent to Kafka.
 package tasks
 
+import "time"
+
 // FileProcessingTask represents the data structure for a file processing job.
 type FileProcessingTask struct {
 	FileMD5   string `json:"file_md5"`
 	ObjectUrl string `json:"object_url"`
+	ObjectKey string `json:"object_key"`
 	FileName  string `json:"file_name"`
 	UserID    uint   `json:"user_id"`
 	OrgTag    string `json:"org_tag"`
 	IsPublic  bool   `json:"is_public"`
 }
+
+// DeadLetterTask is a file processing task that exhausted its retries,
+// as written to the dead-letter topic together with the last error.
+type DeadLetterTask struct {
+	ID       string             `json:"id"`
+	Task     FileProcessingTask `json:"task"`
+	Error    string             `json:"error"`
+	Attempts int                `json:"attempts"`
+	FailedAt time.Time          `json:"failed_at"`
+}
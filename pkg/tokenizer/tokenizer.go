@@ -0,0 +1,49 @@
+// Package tokenizer 提供了与具体模型无关的近似 token 计数。
+// 中文等 CJK 字符按 1 个 token 计，连续的英文字母/数字按每 4 个字符 1 个 token 计，
+// 其余非空白符号各计 1 个 token，空白不计数。该估算与主流 BPE 分词器的量级一致，
+// 足以用于切块大小控制和上下文窗口预算。
+package tokenizer
+
+import "unicode"
+
+// Count 估算文本的 token 数。
+func Count(text string) int {
+	n, _ := walk(text, -1)
+	return n
+}
+
+// Truncate 截取文本前缀，使其 token 数不超过 maxTokens。截断总在 rune 边界上进行。
+func Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	_, end := walk(text, maxTokens)
+	return text[:end]
+}
+
+// walk 遍历文本并累计 token 数。limit >= 0 时，在即将超出 limit 的位置停止，
+// 返回累计 token 数与停止处的字节偏移。
+func walk(text string, limit int) (int, int) {
+	tokens := 0
+	wordLen := 0
+	for i, r := range text {
+		cost := 0
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if wordLen%4 == 0 {
+				cost = 1
+			}
+			wordLen++
+		case unicode.IsSpace(r):
+			wordLen = 0
+		default:
+			cost = 1
+			wordLen = 0
+		}
+		if limit >= 0 && tokens+cost > limit {
+			return tokens, i
+		}
+		tokens += cost
+	}
+	return tokens, len(text)
+}